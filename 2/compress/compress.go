@@ -36,126 +36,23 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"os"
-)
 
-const warn = '~' // znacznik zakodowanej sekwencji znaków
+	"github.com/adbr/npwp/2/compress/rle"
+)
 
 func fatal(err error) {
 	fmt.Fprintf(os.Stderr, "compress: %s\n", err)
 	os.Exit(1)
 }
 
+// compress czyta tekst z r, kompresuje go i zapisuje do w. Kodowanie
+// jest zaimplementowane w pakiecie rle, używanym także przez program
+// expand i program archive (rozdział 3).
 func compress(w io.Writer, r io.Reader) error {
-	bw := bufio.NewWriter(w)
-	defer bw.Flush()
-	br := bufio.NewReader(r)
-
-	// wczytaj pierwszy znak
-	lastc, _, err := br.ReadRune()
-	if err == io.EOF {
-		return nil
-	}
-	if err != nil {
-		return err
-	}
-	n := 1 // licznik znaków w sekwencji
-
-	for {
-		c, _, err := br.ReadRune()
-		if err == io.EOF {
-			if n > 1 || (lastc == warn) {
-				err := putrep(bw, n, lastc)
-				if err != nil {
-					return err
-				}
-			} else {
-				_, err := bw.WriteRune(lastc)
-				if err != nil {
-					return err
-				}
-			}
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-
-		if c == lastc {
-			n++
-		} else if n > 1 || (lastc == warn) { // koniec sekwencji
-			err := putrep(bw, n, lastc)
-			if err != nil {
-				return err
-			}
-			n = 1
-		} else {
-			_, err := bw.WriteRune(lastc)
-			if err != nil {
-				return err
-			}
-		}
-		lastc = c
-	}
-}
-
-// Funkcja putrep zapisuje do w zakodowaną, zwięzłą reprezentację
-// sekwencji n znaków c. Zwraca błąd jeśli wystąpił.
-func putrep(w *bufio.Writer, n int, c rune) error {
-	const (
-		thresh = 4 // koduje tylko sekwencje >= thresh
-		maxrep = 'Z' - 'A' + 1
-	)
-
-	for {
-		if c != warn && n < thresh {
-			break
-		}
-		if c == warn && n <= 0 {
-			break
-		}
-
-		// tylda
-		_, err := w.WriteRune(warn)
-		if err != nil {
-			return err
-		}
-
-		// liczba znaków - zakodowana ('A' == 1, 'B' == 2, ...)
-		cc := 'A' + min(n, maxrep) - 1
-		_, err = w.WriteRune(rune(cc))
-		if err != nil {
-			return err
-		}
-
-		// znak tworzący sekwencje
-		_, err = w.WriteRune(c)
-		if err != nil {
-			return err
-		}
-
-		n -= maxrep
-	}
-
-	// pozostało mniej niż thresh znaków - wypisz normalnie
-	for ; n > 0; n-- {
-		_, err := w.WriteRune(c)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	} else {
-		return b
-	}
+	return rle.Compress(w, r)
 }
 
 func main() {
@@ -3,7 +3,6 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"testing"
 )
@@ -104,56 +103,3 @@ func TestCompress(t *testing.T) {
 		}
 	}
 }
-
-type testPutrep struct {
-	n   int
-	c   rune
-	out string
-}
-
-var testsPutrep = []testPutrep{
-	{0, 'a', ""},
-	{1, 'a', "a"},
-	{2, 'a', "aa"},
-	{3, 'a', "aaa"}, // poniżej progu 4 znaków - nie koduje
-	{4, 'a', "~Da"}, // przekroczenie progu 4 znaków
-	{5, 'a', "~Ea"},
-	{26, 'a', "~Za"}, // najwyższa wartość licznika znaków
-	{27, 'a', "~Zaa"},
-	{28, 'a', "~Zaaa"},
-	{29, 'a', "~Zaaaa"},
-	{30, 'a', "~Za~Da"},
-	{52, 'a', "~Za~Za"},
-	{53, 'a', "~Za~Zaa"},
-	// znaki utf-8
-	{3, 'ą', "ąąą"},
-	{5, 'ą', "~Eą"},
-	// kodowanie znaku ~
-	{0, '~', ""},
-	{1, '~', "~A~"}, // znak ~ jest kodowany także poniżej progu 4 znaków
-	{2, '~', "~B~"},
-	{3, '~', "~C~"},
-	{4, '~', "~D~"},
-	{5, '~', "~E~"},
-	{26, '~', "~Z~"},
-	{27, '~', "~Z~~A~"},
-	{28, '~', "~Z~~B~"},
-}
-
-func TestPutrep(t *testing.T) {
-	for i, tc := range testsPutrep {
-		w := bytes.NewBuffer([]byte{})
-		bw := bufio.NewWriter(w) // bufio.Writer jest wymagany przez putrep
-
-		err := putrep(bw, tc.n, tc.c)
-		if err != nil {
-			t.Error(err)
-		}
-		bw.Flush()
-
-		out := w.String()
-		if out != tc.out {
-			t.Errorf("tc #%d: oczekiwano: %q, jest: %q", i, tc.out, out)
-		}
-	}
-}
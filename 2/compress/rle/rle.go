@@ -0,0 +1,187 @@
+// Pakiet rle implementuje kodowanie serii znaków (run-length encoding)
+// używane przez programy compress i expand (rozdziały 2.3 i 2.4).
+//
+// Sekwencja co najmniej czterech jednakowych znaków x jest kodowana
+// jako ~nx, gdzie n jest liczbą znaków zakodowaną literą: A oznacza 1,
+// B - 2, ..., Z - 26. Sekwencje dłuższe niż 26 znaków są dzielone na
+// kilka krótszych. Znak ~ (tylda) jest kodowany zawsze, nawet
+// pojedynczy.
+//
+// Znakiem jest runa w kodzie UTF-8 lub pojedynczy bajt nie będący
+// poprawnym kodem UTF-8, więc kodowanie jest bezstratne także dla
+// danych binarnych.
+package rle
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+)
+
+const warn = '~' // znacznik zakodowanej sekwencji znaków
+
+const (
+	thresh = 4             // koduje tylko sekwencje >= thresh
+	maxrep = 'Z' - 'A' + 1 // najdłuższa sekwencja w jednym kodzie
+)
+
+// Compress czyta dane z r, koduje sekwencje jednakowych znaków i
+// zapisuje wynik do w.
+func Compress(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriter(w)
+	br := bufio.NewReader(r)
+
+	// wczytaj pierwszy znak
+	lastc, err := getc(br)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	n := 1 // licznik znaków w sekwencji
+
+	for {
+		c, err := getc(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if c == lastc {
+			n++
+			continue
+		}
+		err = putrep(bw, n, lastc) // koniec sekwencji
+		if err != nil {
+			return err
+		}
+		lastc = c
+		n = 1
+	}
+
+	err = putrep(bw, n, lastc)
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Expand czyta z r dane zakodowane przez Compress, dekoduje sekwencje
+// ~nx i zapisuje wynik do w. Błędne lub niepełne kody sekwencji są
+// zapisywane bez zmian.
+func Expand(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriter(w)
+	br := bufio.NewReader(r)
+
+	for {
+		c, err := getc(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// zwykły znak
+		if c != string(warn) {
+			_, err := bw.WriteString(c)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// zakodowana sekwencja
+
+		// wczytaj znak-licznik
+		cn, err := getc(br)
+		if err == io.EOF {
+			_, err := bw.WriteString(c)
+			if err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(cn) != 1 || cn[0] < 'A' || cn[0] > 'Z' {
+			_, err := bw.WriteString(c + cn)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// wczytaj znak sekwencji
+		cc, err := getc(br)
+		if err == io.EOF {
+			_, err := bw.WriteString(c + cn)
+			if err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// wypisz sekwencję
+		for n := cn[0] - 'A' + 1; n > 0; n-- {
+			_, err := bw.WriteString(cc)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// getc czyta z br następny znak: kod UTF-8 runy lub pojedynczy bajt
+// nie będący poprawnym kodem UTF-8.
+func getc(br *bufio.Reader) (string, error) {
+	c, n, err := br.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	if c == utf8.RuneError && n == 1 {
+		br.UnreadRune()
+		b, err := br.ReadByte()
+		return string([]byte{b}), err
+	}
+	return string(c), nil
+}
+
+// putrep zapisuje do w zakodowaną, zwięzłą reprezentację sekwencji n
+// znaków c.
+func putrep(w *bufio.Writer, n int, c string) error {
+	for n >= thresh || (c == string(warn) && n > 0) {
+		// tylda, liczba znaków (zakodowana: 'A' == 1, 'B' == 2, ...)
+		// i znak tworzący sekwencję
+		err := w.WriteByte(warn)
+		if err != nil {
+			return err
+		}
+		err = w.WriteByte(byte('A' + min(n, maxrep) - 1))
+		if err != nil {
+			return err
+		}
+		_, err = w.WriteString(c)
+		if err != nil {
+			return err
+		}
+		n -= maxrep
+	}
+
+	// pozostało mniej niż thresh znaków - wypisz normalnie
+	for ; n > 0; n-- {
+		_, err := w.WriteString(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
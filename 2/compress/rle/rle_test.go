@@ -0,0 +1,94 @@
+package rle
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type testPutrep struct {
+	n   int
+	c   string
+	out string
+}
+
+var testsPutrep = []testPutrep{
+	{0, "a", ""},
+	{1, "a", "a"},
+	{2, "a", "aa"},
+	{3, "a", "aaa"}, // poniżej progu 4 znaków - nie koduje
+	{4, "a", "~Da"}, // przekroczenie progu 4 znaków
+	{5, "a", "~Ea"},
+	{26, "a", "~Za"}, // najwyższa wartość licznika znaków
+	{27, "a", "~Zaa"},
+	{28, "a", "~Zaaa"},
+	{29, "a", "~Zaaaa"},
+	{30, "a", "~Za~Da"},
+	{52, "a", "~Za~Za"},
+	{53, "a", "~Za~Zaa"},
+	// znaki utf-8
+	{3, "ą", "ąąą"},
+	{5, "ą", "~Eą"},
+	// kodowanie znaku ~
+	{0, "~", ""},
+	{1, "~", "~A~"}, // znak ~ jest kodowany także poniżej progu 4 znaków
+	{2, "~", "~B~"},
+	{3, "~", "~C~"},
+	{4, "~", "~D~"},
+	{5, "~", "~E~"},
+	{26, "~", "~Z~"},
+	{27, "~", "~Z~~A~"},
+	{28, "~", "~Z~~B~"},
+}
+
+func TestPutrep(t *testing.T) {
+	for i, tc := range testsPutrep {
+		w := bytes.NewBuffer([]byte{})
+		bw := bufio.NewWriter(w) // bufio.Writer jest wymagany przez putrep
+
+		err := putrep(bw, tc.n, tc.c)
+		if err != nil {
+			t.Error(err)
+		}
+		bw.Flush()
+
+		out := w.String()
+		if out != tc.out {
+			t.Errorf("tc #%d: oczekiwano: %q, jest: %q", i, tc.out, out)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		"",
+		"abc",
+		"aaabbbbb~cccc",
+		"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~",
+		"ąąąąą ęę\n",
+		// dane binarne: bajty nie będące poprawnym kodem UTF-8
+		"\xff\xff\xff\xff\xff\x00\x00\x00\x00",
+		"\xc4\xc4\xc4\xc4\xc4\x85",
+		"a\xe2\x82b\xef\xbf\xbd\xef\xbf\xbd\xef\xbf\xbd\xef\xbf\xbd",
+		strings.Repeat("x", 100) + strings.Repeat("\x80", 60),
+	}
+
+	for i, tc := range tests {
+		c := new(bytes.Buffer)
+		err := Compress(c, strings.NewReader(tc))
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+		e := new(bytes.Buffer)
+		err = Expand(e, bytes.NewReader(c.Bytes()))
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+		if e.String() != tc {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q (kod: %q)", i, tc, e.String(), c.String())
+		}
+	}
+}
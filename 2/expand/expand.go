@@ -32,14 +32,11 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"os"
-)
 
-const (
-	warn = '~' // oznacza początek zakodowanej sekwencji znaków
+	"github.com/adbr/npwp/2/compress/rle"
 )
 
 func fatal(err error) {
@@ -52,95 +49,11 @@ func fatal(err error) {
 // czyli sekwencje powtarzających się znaków są kodowane w postaci
 // ~Nx (N to liczba powtórzeń znaku x zakodowana literą A do Z, gdzie
 // A to 1, B - 2, ..., Z - 26). Zwraca błąd gdy wystąpił. W przypadku
-// błędnych lub nie pełnych kodów sekwencji, wypisuje wypisuje wczytane
-// znaki bez ich interpretacji.
+// błędnych lub nie pełnych kodów sekwencji, wypisuje wczytane znaki
+// bez ich interpretacji. Dekodowanie jest zaimplementowane w pakiecie
+// rle.
 func expand(w io.Writer, r io.Reader) error {
-	// wrappery buffio dla czytania i pisania runów
-	bw := bufio.NewWriter(w)
-	defer bw.Flush()
-	br := bufio.NewReader(r)
-
-	for {
-		c, _, err := br.ReadRune()
-		if err == io.EOF {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-
-		// zwykły znak
-		if c != warn {
-			_, err := bw.WriteRune(c)
-			if err != nil {
-				return err
-			}
-			continue
-		}
-
-		// zakodowana sekwencja
-
-		// wczytaj znak-licznik
-		cn, _, err := br.ReadRune()
-		if err == io.EOF {
-			_, err := bw.WriteRune(c)
-			if err != nil {
-				return err
-			}
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-
-		if !walidCounter(cn) {
-			_, err := bw.WriteRune(c)
-			if err != nil {
-				return err
-			}
-			_, err = bw.WriteRune(cn)
-			if err != nil {
-				return err
-			}
-			continue
-		}
-
-		// wczytaj znak sekwencji
-		cc, _, err := br.ReadRune()
-		if err == io.EOF {
-			_, err := bw.WriteRune(c)
-			if err != nil {
-				return err
-			}
-			_, err = bw.WriteRune(cn)
-			if err != nil {
-				return err
-			}
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-
-		// wypisz sekwencję
-		n := cn - 'A' + 1
-		for ; n > 0; n-- {
-			_, err := bw.WriteRune(cc)
-			if err != nil {
-				return err
-			}
-		}
-	}
-}
-
-// Funkcja walidCounter sprawdza czy znak c jest poprawnym znakiem
-// reprezentującym krotność sekwencji.
-func walidCounter(c rune) bool {
-	if 'A' <= c && c <= 'Z' {
-		return true
-	} else {
-		return false
-	}
+	return rle.Expand(w, r)
 }
 
 func main() {
@@ -0,0 +1,258 @@
+// Pakiet arch implementuje czytanie i zapisywanie archiwum plików w
+// formacie programu archive. Archiwum jest sekwencją plików, z których
+// każdy jest poprzedzony nagłówkiem (pakiet header). Interfejs jest
+// wzorowany na pakiecie archive/tar: Writer zapisuje nagłówek metodą
+// WriteHeader, a następnie zawartość pliku metodą Write; Reader
+// przechodzi do następnego pliku metodą Next, a zawartość bieżącego
+// pliku udostępnia metodą Read.
+package arch
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/adbr/npwp/3/archive/header"
+)
+
+var (
+	// ErrWriteTooLong jest zwracany gdy zapisano więcej bajtów niż
+	// podano w nagłówku pliku.
+	ErrWriteTooLong = errors.New("arch: write too long")
+
+	// ErrWriteAfterClose jest zwracany przy zapisie po Close.
+	ErrWriteAfterClose = errors.New("arch: write after close")
+
+	// ErrChecksum jest zwracany przez Read po przeczytaniu całego
+	// pliku, jeśli jego suma kontrolna jest inna niż w nagłówku.
+	ErrChecksum = errors.New("arch: checksum mismatch")
+)
+
+// Reader umożliwia sekwencyjne czytanie plików z archiwum.
+type Reader struct {
+	r   io.Reader
+	br  *bufio.Reader
+	rs  io.Seeker      // r, jeśli umożliwia przesuwanie pozycji; lub nil
+	nb  int64          // liczba nieprzeczytanych bajtów bieżącego pliku
+	err error          // błąd, po którym dalsze czytanie jest niemożliwe
+	hdr *header.Header // nagłówek bieżącego pliku
+	sum hash.Hash      // suma kontrolna przeczytanej części bieżącego pliku
+}
+
+// NewReader tworzy Reader czytający archiwum z r. Jeśli r implementuje
+// io.Seeker (np. jest zwykłym plikiem), to pliki pomijane przez Next
+// są przeskakiwane metodą Seek, bez czytania ich zawartości.
+func NewReader(r io.Reader) *Reader {
+	tr := &Reader{r: r, br: bufio.NewReader(r)}
+	if rs, ok := r.(io.Seeker); ok {
+		// np. os.Stdin połączony z potokiem nie umożliwia Seek
+		_, err := rs.Seek(0, io.SeekCurrent)
+		if err == nil {
+			tr.rs = rs
+		}
+	}
+	return tr
+}
+
+// Next przechodzi do następnego pliku w archiwum i zwraca jego
+// nagłówek. Nieprzeczytana część bieżącego pliku jest pomijana. Indeks
+// archiwum (plik rodzaju header.TypeIndex) jest pomijany. Na końcu archiwum zwraca
+// io.EOF.
+func (tr *Reader) Next() (*header.Header, error) {
+	if tr.err != nil {
+		return nil, tr.err
+	}
+
+	var hdr *header.Header
+	for {
+		err := tr.skip(tr.nb)
+		if err != nil {
+			tr.err = err
+			return nil, err
+		}
+
+		hdr, err = header.Read(tr.br)
+		if err != nil {
+			tr.err = err
+			return nil, err
+		}
+		tr.nb = hdr.Size
+		if hdr.Type != header.TypeIndex {
+			break
+		}
+	}
+	tr.hdr = hdr
+	tr.sum = nil
+	if hdr.Sum != "" {
+		var err error
+		tr.sum, err = header.NewHash(hdr.SumAlg())
+		if err != nil {
+			tr.err = err
+			return nil, err
+		}
+	}
+	return hdr, nil
+}
+
+// skip pomija n bajtów archiwum. Jeśli bajty nie są już w buforze, a
+// archiwum umożliwia Seek, to przesuwa pozycję w archiwum i opróżnia
+// bufor; w przeciwnym razie czyta i odrzuca bajty.
+func (tr *Reader) skip(n int64) error {
+	if tr.rs != nil && n > int64(tr.br.Buffered()) {
+		return tr.seek(n)
+	}
+	m, err := io.CopyN(io.Discard, tr.br, n)
+	tr.nb -= m
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// seek pomija n bajtów archiwum przesuwając pozycję w archiwum metodą
+// Seek. Uwzględnia bajty znajdujące się w buforze. Zwraca
+// io.ErrUnexpectedEOF jeśli nowa pozycja jest za końcem archiwum.
+func (tr *Reader) seek(n int64) error {
+	off := n - int64(tr.br.Buffered())
+	pos, err := tr.rs.Seek(off, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	end, err := tr.rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if pos > end {
+		return io.ErrUnexpectedEOF
+	}
+	_, err = tr.rs.Seek(pos, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	tr.br.Reset(tr.r)
+	tr.nb -= n
+	return nil
+}
+
+// Read czyta zawartość bieżącego pliku archiwum. Na końcu pliku zwraca
+// io.EOF. Jeśli archiwum kończy się przed końcem pliku, to zwraca
+// io.ErrUnexpectedEOF. Jeśli nagłówek zawiera sumę kontrolną, to po
+// przeczytaniu całego pliku jest ona sprawdzana i w przypadku
+// niezgodności zwracany jest ErrChecksum. Pliki pomijane przez Next
+// nie są sprawdzane.
+func (tr *Reader) Read(b []byte) (int, error) {
+	if tr.err != nil {
+		return 0, tr.err
+	}
+	if tr.nb == 0 {
+		if tr.sum != nil && !tr.check() {
+			return 0, ErrChecksum
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(b)) > tr.nb {
+		b = b[:tr.nb]
+	}
+	n, err := tr.br.Read(b)
+	tr.nb -= int64(n)
+	if tr.sum != nil {
+		tr.sum.Write(b[:n])
+		if tr.nb == 0 && !tr.check() {
+			return n, ErrChecksum
+		}
+	}
+	if err == io.EOF && tr.nb > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF {
+		tr.err = err
+	}
+	return n, err
+}
+
+// check porównuje sumę kontrolną przeczytanego pliku z sumą w jego
+// nagłówku. Suma jest sprawdzana tylko raz.
+func (tr *Reader) check() bool {
+	sum := header.FormatSum(tr.hdr.SumAlg(), tr.sum)
+	tr.sum = nil
+	return sum == tr.hdr.Sum
+}
+
+// Writer umożliwia sekwencyjne zapisywanie plików do archiwum.
+type Writer struct {
+	w      io.Writer
+	nb     int64        // liczba bajtów bieżącego pliku do zapisania
+	off    int64        // liczba bajtów zapisanych do w
+	index  []IndexEntry // zapisane pliki (do indeksu)
+	closed bool
+}
+
+// NewWriter tworzy Writer zapisujący archiwum do w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteHeader zapisuje nagłówek hdr i przygotowuje Writer do zapisania
+// hdr.Size bajtów zawartości pliku. Zwraca błąd jeśli poprzedni plik
+// nie został zapisany w całości.
+func (tw *Writer) WriteHeader(hdr *header.Header) error {
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	s := hdr.String()
+	n, err := io.WriteString(tw.w, s)
+	if err != nil {
+		return err
+	}
+	h := *hdr
+	tw.index = append(tw.index, IndexEntry{tw.off, &h})
+	tw.off += int64(n)
+	tw.nb = hdr.Size
+	return nil
+}
+
+// Write zapisuje zawartość bieżącego pliku. Zwraca ErrWriteTooLong
+// jeśli zapisano więcej bajtów niż podano w nagłówku.
+func (tw *Writer) Write(b []byte) (int, error) {
+	if tw.closed {
+		return 0, ErrWriteAfterClose
+	}
+
+	var err error
+	if int64(len(b)) > tw.nb {
+		b = b[:tw.nb]
+		err = ErrWriteTooLong
+	}
+	n, werr := tw.w.Write(b)
+	tw.nb -= int64(n)
+	tw.off += int64(n)
+	if werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// Flush sprawdza czy bieżący plik został zapisany w całości.
+func (tw *Writer) Flush() error {
+	if tw.closed {
+		return ErrWriteAfterClose
+	}
+	if tw.nb > 0 {
+		return fmt.Errorf("arch: missed writing %d bytes", tw.nb)
+	}
+	return nil
+}
+
+// Close kończy zapisywanie archiwum. Nie zamyka w.
+func (tw *Writer) Close() error {
+	if tw.closed {
+		return nil
+	}
+	err := tw.Flush()
+	tw.closed = true
+	return err
+}
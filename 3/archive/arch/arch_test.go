@@ -0,0 +1,580 @@
+package arch
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adbr/npwp/3/archive/header"
+)
+
+// Typ file zawiera nazwę i zawartość pliku w archiwum.
+type file struct {
+	name string
+	data string
+}
+
+// readAll czyta wszystkie pliki z archiwum tr.
+func readAll(tr *Reader) ([]file, error) {
+	var files []file
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file{hdr.Name, string(data)})
+	}
+}
+
+func TestReader(t *testing.T) {
+	f, err := os.Open("../testfiles/qq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	files, err := readAll(NewReader(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []file{
+		{"a", "aaa\n"},
+		{"d", "dddd"},
+		{"b", "bbb\n"},
+		{"c", ""},
+	}
+	if len(files) != len(exp) {
+		t.Fatalf("oczekiwano: %v, jest: %v", exp, files)
+	}
+	for i := range exp {
+		if files[i] != exp[i] {
+			t.Errorf("#%d: oczekiwano: %v, jest: %v", i, exp[i], files[i])
+		}
+	}
+}
+
+func TestReaderSkip(t *testing.T) {
+	// pliki nie przeczytane w całości są pomijane przez Next
+	in := "-h- a 4\naaa\n-h- b 3\nbbb"
+	tr := NewReader(bytes.NewBufferString(in))
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	_, err = tr.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, err = tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != "b" {
+		t.Errorf("oczekiwano pliku b, jest: %s", hdr.Name)
+	}
+	_, err = tr.Next()
+	if err != io.EOF {
+		t.Errorf("oczekiwano io.EOF, jest: %v", err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []string{
+		"../testfiles/qqa", // zły magic string drugiego pliku
+		"../testfiles/qqb", // zły rozmiar pierwszego pliku
+		"../testfiles/qqc", // zła liczba pól w nagłówku
+		"../testfiles/qqd", // nagłówek nie zakończony znakiem \n
+		"../testfiles/qqe", // rozmiar pliku większy niż archiwum
+	}
+
+	for _, name := range tests {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = readAll(NewReader(f))
+		if err == nil {
+			t.Errorf("%s: powinien wystąpić błąd", name)
+		}
+		f.Close()
+	}
+
+	// archiwum kończy się przed końcem pliku
+	tr := NewReader(bytes.NewBufferString("-h- a 10\nabc"))
+	_, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(tr)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("oczekiwano io.ErrUnexpectedEOF, jest: %v", err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	files := []file{
+		{"a", "aaa\n"},
+		{"d", "dddd"},
+		{"b", "bbb\n"},
+		{"c", ""},
+	}
+
+	buf := new(bytes.Buffer)
+	tw := NewWriter(buf)
+	for _, f := range files {
+		hdr := &header.Header{
+			Mark: "-h-",
+			Name: f.name,
+			Size: int64(len(f.data)),
+		}
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.WriteString(tw, f.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp, err := os.ReadFile("../testfiles/qq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(exp) {
+		t.Errorf("oczekiwano: %q, jest: %q", exp, buf.String())
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	hdr := &header.Header{Mark: "-h-", Name: "a", Size: 3}
+
+	// za dużo danych
+	tw := NewWriter(new(bytes.Buffer))
+	err := tw.WriteHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.WriteString(tw, "abcd")
+	if err != ErrWriteTooLong || n != 3 {
+		t.Errorf("oczekiwano 3, ErrWriteTooLong, jest: %d, %v", n, err)
+	}
+
+	// za mało danych
+	tw = NewWriter(new(bytes.Buffer))
+	err = tw.WriteHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.WriteString(tw, "ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tw.WriteHeader(hdr)
+	if err == nil {
+		t.Error("WriteHeader: powinien wystąpić błąd")
+	}
+	err = tw.Close()
+	if err == nil {
+		t.Error("Close: powinien wystąpić błąd")
+	}
+
+	// zapis po Close
+	_, err = io.WriteString(tw, "a")
+	if err != ErrWriteAfterClose {
+		t.Errorf("oczekiwano ErrWriteAfterClose, jest: %v", err)
+	}
+}
+
+func TestReaderChecksum(t *testing.T) {
+	type test struct {
+		in string // archiwum
+		e  error  // oczekiwany błąd Read
+	}
+	tests := []test{
+		{"-h- a 4 sum=crc32:77f85d95\naaa\n", nil},
+		{"-h- a 4 sum=crc32:77f85d95\naab\n", ErrChecksum},
+		{"-h- a 0 sum=crc32:00000000\n", nil},
+		{"-h- a 0 sum=crc32:00000001\n", ErrChecksum},
+		{"-h- a 4 sum=sha256:17e682f060b5f8e47ea04c5c4855908b0a5ad612022260fe50e11ecb0cc0ab76\naaa\n", nil},
+		{"-h- a 4 sum=sha256:17e682f060b5f8e47ea04c5c4855908b0a5ad612022260fe50e11ecb0cc0ab77\naaa\n", ErrChecksum},
+	}
+
+	for i, tc := range tests {
+		tr := NewReader(bytes.NewBufferString(tc.in))
+		_, err := tr.Next()
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+		_, err = io.ReadAll(tr)
+		if err != tc.e {
+			t.Errorf("#%d: oczekiwano: %v, jest: %v", i, tc.e, err)
+		}
+	}
+}
+
+// stream ukrywa metodę Seek readera r.
+type stream struct {
+	r io.Reader
+}
+
+func (s stream) Read(b []byte) (int, error) {
+	return s.r.Read(b)
+}
+
+func TestReaderSeek(t *testing.T) {
+	// pominięcie pliku za pomocą Seek, w tym pliku częściowo
+	// przeczytanego i pliku mieszczącego się w buforze
+	name := filepath.Join(t.TempDir(), "a")
+	var files []file
+	for i := 0; i < 10; i++ {
+		data := strings.Repeat(string(rune('a'+i)), i*2000)
+		files = append(files, file{fmt.Sprintf("f%d", i), data})
+	}
+	writeArchive(t, name, files)
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tr := NewReader(f)
+	if tr.rs == nil {
+		t.Fatal("oczekiwano Reader z Seek")
+	}
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != files[i].name {
+			t.Errorf("#%d: oczekiwano: %s, jest: %s", i, files[i].name, hdr.Name)
+		}
+		if i%3 == 0 {
+			continue
+		}
+		b := make([]byte, 10)
+		n, _ := io.ReadFull(tr, b)
+		if string(b[:n]) != files[i].data[:n] {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, files[i].data[:n], b[:n])
+		}
+	}
+
+	// plik dłuższy niż archiwum
+	f, err = os.Open("../testfiles/qqe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tr = NewReader(f)
+	for err == nil {
+		_, err = tr.Next()
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("oczekiwano io.ErrUnexpectedEOF, jest: %v", err)
+	}
+}
+
+// writeArchive zapisuje archiwum name zawierające pliki files.
+func writeArchive(tb testing.TB, name string, files []file) {
+	f, err := os.Create(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	tw := NewWriter(bw)
+	for _, file := range files {
+		hdr := &header.Header{
+			Mark: "-h-",
+			Name: file.name,
+			Size: int64(len(file.data)),
+		}
+		err := tw.WriteHeader(hdr)
+		if err == nil {
+			_, err = io.WriteString(tw, file.data)
+		}
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	err = tw.Close()
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// benchArchive tworzy archiwum zawierające 64 pliki po 256 KB i zwraca
+// jego nazwę.
+func benchArchive(b *testing.B) string {
+	name := filepath.Join(b.TempDir(), "bench")
+	var files []file
+	for i := 0; i < 64; i++ {
+		data := strings.Repeat("abcdefgh", 32*1024)
+		files = append(files, file{fmt.Sprintf("f%d", i), data})
+	}
+	writeArchive(b, name, files)
+	return name
+}
+
+// benchList czyta nagłówki wszystkich plików archiwum name, jak
+// archive -t. Jeśli seek jest false, to Seek nie jest używany.
+func benchList(b *testing.B, seek bool) {
+	name := benchArchive(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var r io.Reader = f
+		if !seek {
+			r = stream{f}
+		}
+		tr := NewReader(r)
+		for {
+			_, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		f.Close()
+	}
+}
+
+// fskip i acopy są wersjami pomijania i kopiowania zawartości plików
+// archiwum sprzed pakietu arch, czytającymi bajt po bajcie - do
+// porównania w benchmarkach.
+
+func fskip(r *bufio.Reader, n int64) error {
+	for i := int64(0); i < n; i++ {
+		_, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func acopy(dst *bufio.Writer, src *bufio.Reader, n int64) error {
+	for i := int64(0); i < n; i++ {
+		c, err := src.ReadByte()
+		if err != nil {
+			return err
+		}
+		err = dst.WriteByte(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchBytes czyta nagłówki wszystkich plików archiwum name, a ich
+// zawartość kopiuje do w funkcją acopy lub, jeśli w jest nil, pomija
+// funkcją fskip - tak jak program archive przed użyciem pakietu arch.
+func benchBytes(b *testing.B, w *bufio.Writer) {
+	name := benchArchive(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		br := bufio.NewReader(f)
+		for {
+			hdr, err := header.Read(br)
+			if err == io.EOF {
+				break
+			}
+			if err == nil && w == nil {
+				err = fskip(br, hdr.Size)
+			} else if err == nil {
+				err = acopy(w, br, hdr.Size)
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		f.Close()
+	}
+}
+
+// Porównanie pomijania plików przez Seek, przez czytanie (io.CopyN) i
+// przez czytanie bajt po bajcie (fskip), np.:
+//
+// % go test -bench List
+// BenchmarkListSeek   	    4665	    242467 ns/op
+// BenchmarkListStream 	     248	   4575288 ns/op
+// BenchmarkListBytes  	      12	  86654766 ns/op
+//
+// czyli wykaz archiwum 16 MB jest prawie 20 razy szybszy, gdy zawartość
+// plików jest przeskakiwana przez Seek, a czytanie przez io.CopyN jest
+// również prawie 20 razy szybsze niż bajt po bajcie.
+
+func BenchmarkListSeek(b *testing.B) {
+	benchList(b, true)
+}
+
+func BenchmarkListStream(b *testing.B) {
+	benchList(b, false)
+}
+
+func BenchmarkListBytes(b *testing.B) {
+	benchBytes(b, nil)
+}
+
+// Porównanie kopiowania zawartości wszystkich plików archiwum przez
+// io.CopyN i bajt po bajcie (acopy), np.:
+//
+// % go test -bench Copy
+// BenchmarkCopyN      	     254	   4687814 ns/op
+// BenchmarkCopyBytes  	       7	 152198984 ns/op
+//
+// czyli kopiowanie przez io.CopyN jest ponad 30 razy szybsze.
+
+func BenchmarkCopyN(b *testing.B) {
+	name := benchArchive(b)
+	w := bufio.NewWriter(io.Discard)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		tr := NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err == nil {
+				_, err = io.CopyN(w, tr, hdr.Size)
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		f.Close()
+	}
+}
+
+func BenchmarkCopyBytes(b *testing.B) {
+	benchBytes(b, bufio.NewWriter(io.Discard))
+}
+
+func TestIndex(t *testing.T) {
+	files := []file{
+		{"a", "aaa\n"},
+		{"my file", "dddd"},
+		{IndexName, "zwykły plik o nazwie indeksu\n"},
+		{"c", ""},
+	}
+	buf := new(bytes.Buffer)
+	tw := NewWriter(buf)
+	for _, f := range files {
+		hdr := &header.Header{Mark: "-h-", Name: f.name, Size: int64(len(f.data))}
+		err := tw.WriteHeader(hdr)
+		if err == nil {
+			_, err = io.WriteString(tw, f.data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tw.WriteIndex()
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	// czytanie indeksu i plików z pozycji w indeksie
+	rs := bytes.NewReader(archive)
+	index, err := ReadIndex(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != len(files) {
+		t.Fatalf("oczekiwano %d plików w indeksie, jest: %d", len(files), len(index))
+	}
+	for i, e := range index {
+		if e.Header.Name != files[i].name {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, files[i].name, e.Header.Name)
+		}
+		_, err := rs.Seek(e.Offset, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := NewReader(rs)
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != files[i].name || string(data) != files[i].data {
+			t.Errorf("#%d: oczekiwano: %v, jest: %v", i, files[i], file{hdr.Name, string(data)})
+		}
+	}
+
+	// indeks jest pomijany przy czytaniu sekwencyjnym, a zwykły plik
+	// o nazwie IndexName nie
+	got, err := readAll(NewReader(bytes.NewReader(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(files) {
+		t.Fatalf("oczekiwano: %v, jest: %v", files, got)
+	}
+	for i := range files {
+		if got[i] != files[i] {
+			t.Errorf("#%d: oczekiwano: %v, jest: %v", i, files[i], got[i])
+		}
+	}
+
+	// archiwum bez indeksu lub z indeksem uszkodzonym
+	bad := [][]byte{
+		[]byte("-h- a 4\naaa\n"),
+		append(append([]byte{}, archive...), "-h- x 0\n"...),
+		archive[:len(archive)-1],
+		archive[len(archive)-footerLen-40:],
+	}
+	for i, a := range bad {
+		_, err := ReadIndex(bytes.NewReader(a))
+		if err != ErrNoIndex {
+			t.Errorf("#%d: oczekiwano ErrNoIndex, jest: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package arch
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/adbr/npwp/3/archive/header"
+)
+
+// Indeks archiwum jest zapisywany jako ostatni plik archiwum, o nazwie
+// IndexName i rodzaju header.TypeIndex (pole type=index nagłówka),
+// więc archiwum z indeksem może być czytane sekwencyjnie. Indeks jest
+// rozpoznawany po rodzaju, a nie po nazwie, więc zwykły plik o nazwie
+// IndexName może być zapisany w archiwum. Zawartość indeksu to wiersze
+// postaci:
+//
+//	offset nagłówek
+//
+// gdzie offset jest pozycją nagłówka pliku w archiwum, a nagłówek jest
+// kopią nagłówka pliku (razem z kończącym go znakiem \n). Indeks kończy
+// się stopką o stałej długości footerLen:
+//
+//	-i- 00000000000000001234
+//
+// zawierającą pozycję nagłówka pliku indeksu w archiwum, dzięki czemu
+// indeks można znaleźć czytając tylko koniec archiwum.
+
+// IndexName jest nazwą pliku zawierającego indeks archiwum.
+const IndexName = ".archive-index"
+
+const (
+	footerMark = "-i-"                   // znacznik stopki indeksu
+	footerLen  = len(footerMark) + 22    // długość stopki: "-i- " + 20 cyfr + "\n"
+	footerFmt  = footerMark + " %020d\n" // format stopki
+)
+
+// ErrNoIndex jest zwracany przez ReadIndex jeśli archiwum nie zawiera
+// poprawnego indeksu.
+var ErrNoIndex = errors.New("arch: no index")
+
+// IndexEntry opisuje plik w indeksie archiwum.
+type IndexEntry struct {
+	Offset int64          // pozycja nagłówka pliku w archiwum
+	Header *header.Header // nagłówek pliku
+}
+
+// WriteIndex zapisuje na końcu archiwum indeks wszystkich plików
+// zapisanych przez tw. Po zapisaniu indeksu należy wywołać Close.
+func (tw *Writer) WriteIndex() error {
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, e := range tw.index {
+		fmt.Fprintf(&buf, "%d %s", e.Offset, e.Header)
+	}
+	fmt.Fprintf(&buf, footerFmt, tw.off)
+
+	hdr := &header.Header{
+		Mark: "-h-",
+		Name: IndexName,
+		Size: int64(buf.Len()),
+		Type: header.TypeIndex,
+	}
+	err = tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(buf.Bytes())
+	return err
+}
+
+// ReadIndex czyta indeks archiwum rs. Czyta tylko stopkę i plik
+// indeksu, znajdujące się na końcu archiwum. Jeśli archiwum nie ma
+// indeksu lub indeks jest niepoprawny (np. archiwum zostało zmienione
+// programem nie znającym indeksu), to zwraca ErrNoIndex.
+func ReadIndex(rs io.ReadSeeker) ([]IndexEntry, error) {
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if end < int64(footerLen) {
+		return nil, ErrNoIndex
+	}
+	_, err = rs.Seek(end-int64(footerLen), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	footer := make([]byte, footerLen)
+	_, err = io.ReadFull(rs, footer)
+	if err != nil {
+		return nil, err
+	}
+	off, ok := parseFooter(string(footer))
+	if !ok || off >= end {
+		return nil, ErrNoIndex
+	}
+
+	_, err = rs.Seek(off, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(rs)
+	hdr, err := header.Read(br)
+	if err != nil {
+		return nil, ErrNoIndex
+	}
+	if hdr.Type != header.TypeIndex || hdr.Size < int64(footerLen) ||
+		off+int64(len(hdr.String()))+hdr.Size != end {
+		return nil, ErrNoIndex
+	}
+
+	var index []IndexEntry
+	lr := bufio.NewReader(io.LimitReader(br, hdr.Size-int64(footerLen)))
+	for {
+		line, err := lr.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil {
+			return nil, ErrNoIndex
+		}
+		e, ok := parseEntry(line)
+		if !ok {
+			return nil, ErrNoIndex
+		}
+		index = append(index, e)
+	}
+	return index, nil
+}
+
+// parseFooter parsuje stopkę indeksu s i zwraca zapisaną w niej
+// pozycję pliku indeksu.
+func parseFooter(s string) (int64, bool) {
+	if !strings.HasPrefix(s, footerMark+" ") || !strings.HasSuffix(s, "\n") {
+		return 0, false
+	}
+	n := s[len(footerMark)+1 : len(s)-1]
+	off, err := strconv.ParseInt(n, 10, 64)
+	if err != nil || off < 0 {
+		return 0, false
+	}
+	return off, true
+}
+
+// parseEntry parsuje wiersz indeksu line.
+func parseEntry(line string) (IndexEntry, bool) {
+	n, s, ok := strings.Cut(line, " ")
+	if !ok {
+		return IndexEntry{}, false
+	}
+	off, err := strconv.ParseInt(n, 10, 64)
+	if err != nil || off < 0 {
+		return IndexEntry{}, false
+	}
+	hdr, err := header.Parse(s)
+	if err != nil {
+		return IndexEntry{}, false
+	}
+	return IndexEntry{off, hdr}, true
+}
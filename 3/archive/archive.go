@@ -11,6 +11,8 @@
 // SPOSÓB UŻYCIA
 //
 // archive -cmd aname [file ...]
+// archive -export tar|zip aname [file ...]
+// archive -import file aname
 //
 // OPIS
 //
@@ -23,8 +25,10 @@
 //	-c  utworzenie nowego archiwum zawierającego podane pliki
 //	-d  usunięcie podanych plików z archiwum
 //	-p  wypisanie podanych plików na standardowe wyjście
+//	-s  porównanie podanych plików archiwum z plikami na dysku
 //	-t  wypisanie wykazu plików zawartych w archiwum
 //	-u  uaktualnienie lub dodanie podanych plików
+//	-v  sprawdzenie sum kontrolnych podanych plików
 //	-x  wydobycie podanych plików z archiwum
 //
 // Jeśli nie poda się nazw plików to operacje dotyczą wszystkich plików
@@ -43,6 +47,122 @@
 //	-h- nazwa długość
 //
 // gdzie nazwa jest nazwą pliku, a długość jest długością pliku.
+// Nazwa zawierająca cudzysłów, odstępy, znaki niedrukowalne lub bajty
+// nie będące poprawnym kodem UTF-8 jest zapisywana w cudzysłowie z
+// sekwencjami escape jak w języku Go, np.:
+//
+//	-h- "my file.txt" 123
+//
+// Po długości mogą występować pola key=value z metadanymi pliku:
+// rodzajem (type=file, dir lub symlink), prawami dostępu (mode),
+// czasem modyfikacji (mtime), właścicielem i grupą (uid, gid) oraz
+// celem dowiązania symbolicznego (link), np.:
+//
+//	-h- a.txt 123 type=file mode=0644 mtime=1412345678 uid=1000 gid=1000
+//
+// Nagłówki bez tych pól (ze starszych archiwów) są nadal czytane.
+//
+// Nagłówek może też zawierać sumę kontrolną zawartości pliku (pole sum),
+// np. sum=crc32:3610a686. Sumy są obliczane przy -c i -u algorytmem
+// podanym w opcji -sum: crc32 (domyślnie), sha256 lub none (bez sum).
+// Sumy są sprawdzane przy czytaniu zawartości plików (-p, -x, -u, -d),
+// a parametr -v sprawdza wszystkie (lub podane) pliki archiwum i
+// drukuje, które z nich są uszkodzone.
+//
+// Opcja -z enc parametrów -c i -u powoduje zapisywanie plików w
+// archiwum w postaci skompresowanej metodą enc. Obecnie dostępna jest
+// metoda rle - kodowanie serii znaków jak w programie compress
+// (rozdział 2.3). Plik jest zapisywany bez kompresji, jeśli nie
+// zmniejsza ona jego rozmiaru. Nagłówek pliku skompresowanego zawiera
+// pola enc (metoda) i usize (rozmiar przed kompresją); długością jest
+// rozmiar danych w archiwum. Parametry -p i -x dekompresują pliki, a
+// -t drukuje oba rozmiary.
+//
+// Katalogi podane jako argumenty -c i -u są dodawane do archiwum
+// rekurencyjnie, razem z zawartością; nazwa katalogu w argumentach -d,
+// -p, -s, -t, -v i -x oznacza katalog z całą zawartością. Przy
+// wydobywaniu plików (-x) odtwarzane są katalogi, dowiązania
+// symboliczne, prawa dostępu i czasy modyfikacji, a w przypadku
+// użytkownika root także właściciel i grupa plików.
+//
+// Opcje parametru -x:
+//
+//	-C dir   wydobycie plików do katalogu dir zamiast bieżącego
+//	--force  zastępowanie istniejących plików
+//
+// Wydobywane pliki nie mogą znaleźć się poza katalogiem docelowym:
+// pliki o nazwach bezwzględnych lub zawierających "..", pliki w
+// katalogach będących dowiązaniami symbolicznymi i dowiązania
+// wskazujące poza katalog docelowy są odrzucane z komunikatem błędu.
+// Bez opcji --force istniejące pliki nie są zastępowane.
+//
+// Nazwy plików w argumentach -d, -p, -t, -v i -x mogą być wzorcami
+// jak w powłoce (patrz path.Match), np. '*.go' - trzeba je wtedy ująć
+// w apostrofy. Wzorzec bez znaku '/' jest dopasowywany do ostatniego
+// elementu nazwy pliku, więc *.go wybiera pliki .go we wszystkich
+// katalogach; wzorzec z '/' jest dopasowywany do całej nazwy. Opcja
+// -e pat tych parametrów wybiera pliki, których nazwy zawierają
+// fragment pasujący do wzorca pat w składni programu find (rozdział
+// 5, pakiet pattern), np. -e '.go$'. Opcja może wystąpić
+// wielokrotnie. Wybrane są pliki pasujące do którejkolwiek nazwy lub
+// wzorca. Na końcu drukowane są nazwy plików nie znalezionych w
+// archiwum i wzorce, do których nie pasuje żaden plik.
+//
+// Opcja -i parametrów -c i -u powoduje zapisanie na końcu archiwum
+// indeksu - wykazu nagłówków plików wraz z ich pozycjami w archiwum.
+// Jeśli archiwum ma indeks, to -t czyta tylko indeks, a -p i -x z
+// podanymi nazwami plików czytają tylko te pliki. Indeks jest
+// odtwarzany przez -u i -d. Indeks jest zapisany jako ostatni plik
+// archiwum, o nazwie .archive-index i z polem type=index w nagłówku,
+// który jest pomijany przy czytaniu archiwum.
+//
+// Zmiana formatu przez indeks jest zamierzona: wersje programu archive,
+// które nie znają pola type=index, zgłaszają przy czytaniu indeksu błąd
+// nieznanego rodzaju pliku, a wersje czytające tylko nagłówki z trzema
+// polami (bez metadanych) nie czytają nagłówka indeksu, tak jak
+// nagłówków z metadanymi. Archiwum przeznaczone dla starszych wersji
+// należy tworzyć bez opcji -i; indeks istniejącego archiwum jest
+// zachowywany przez -u i -d, więc usunąć go można tylko tworząc
+// archiwum od nowa.
+//
+// Operacje -c, -d i -u zapisują nowe archiwum do pliku tymczasowego w
+// katalogu archiwum, który po zapisaniu (i synchronizacji na dysk)
+// zastępuje archiwum przez zmianę nazwy. Błąd lub przerwanie programu
+// nie uszkadza więc archiwum. Jednoczesne zmiany jednego archiwum
+// przez kilka procesów archive są szeregowane za pomocą blokady pliku
+// aname.lock. Archiwum, jego plik tymczasowy i plik blokady nie są
+// dodawane do archiwum, także gdy argumentem jest zawierający je
+// katalog.
+//
+// Parametr -s porównuje pliki archiwum (wszystkie lub podane) z
+// plikami o tych samych nazwach na dysku, podobnie jak tar --diff, i
+// drukuje pliki, które się różnią:
+//
+//	a.txt: ZMIENIONY: zawartość
+//	b.txt: BRAK NA DYSKU
+//	d/c.txt: NOWY
+//
+// Porównywany jest rodzaj pliku, prawa dostępu, cel dowiązania,
+// rozmiar i zawartość (za pomocą sumy kontrolnej, jeśli jest w
+// nagłówku), ale nie czas modyfikacji. Pliki nowe (nie występujące w
+// archiwum) są szukane wśród podanych nazw plików i w zawartości
+// podanych katalogów - czyli tam, gdzie dodałby je parametr -u. Jeśli
+// są jakieś różnice, to program kończy się kodem błędu.
+//
+// Parametr -export format zapisuje na standardowe wyjście archiwum w
+// formacie tar lub zip zawierające wszystkie (lub podane) pliki
+// archiwum aname. Parametr -import src tworzy archiwum aname z plików
+// archiwum src w formacie tar lub zip (format jest rozpoznawany po
+// zawartości pliku); można przy tym użyć opcji -i, -sum i -z. Metadane
+// plików są przenoszone w miarę możliwości - format zip nie zawiera
+// właściciela i grupy pliku. Pliki, których nie można zapisać w
+// archiwum (np. pliki urządzeń i dowiązania twarde z archiwum tar),
+// są pomijane z ostrzeżeniem.
+//
+// Czytanie i zapisywanie archiwum jest zaimplementowane w pakiecie
+// arch, który może być używany przez inne programy. Zawartość plików
+// pomijanych przy -t, -p i -x nie jest czytana - jest przeskakiwana
+// przez zmianę pozycji w pliku archiwum.
 //
 // PRZYKŁADY
 //
@@ -50,6 +170,19 @@
 //
 //	archive -u archfile old1 old2 new1
 //
+// Wydobycie wszystkich plików .go:
+//
+//	archive -x archfile '*.go'
+//
+// Sprawdzenie, czy archiwum trzeba uaktualnić:
+//
+//	archive -s archfile dir
+//
+// Zamiana archiwum na format tar i z powrotem:
+//
+//	archive -export tar archfile > archfile.tar
+//	archive -import archfile.tar archfile
+//
 // Wypisanie skorowidza archiwum:
 //
 //	archive -t archfile
@@ -61,35 +194,144 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/adbr/npwp/3/archive/arch"
 	"github.com/adbr/npwp/3/archive/header"
+	"github.com/adbr/npwp/5/pattern"
 )
 
 const (
-	tempname = "archive" // prefix nazwy tymczasowego pliku archiwum
+	tempname = "archive" // prefix nazwy pliku tymczasowego (patrz compressfile, importmember)
 )
 
 var (
 	fnames []string // nazwy plików będących argumentami polecenia
 	fstats []bool   // czy i-ty plik z fnames jest już w archiwum
+	fglobs []bool   // czy i-ty element fnames jest wzorcem (glob)
 )
 
+// Wzorce wyboru plików (opcja -e).
+var (
+	epats  []pattern.Pattern // skompilowane wzorce
+	etexts []string          // wzorce w postaci podanej w poleceniu
+	estats []bool            // czy i-ty wzorzec pasuje do pliku w archiwum
+)
+
+// Opcje polecenia -x.
+var (
+	destdir = "."   // katalog, do którego są wydobywane pliki (-C)
+	force   = false // czy zastępować istniejące pliki (--force)
+)
+
+// Opcje poleceń -c i -u.
+var (
+	sumalg  = header.SumCRC32 // algorytm sum kontrolnych (-sum); "" - bez sum
+	zipalg  = ""              // metoda kompresji plików (-z); "" - bez kompresji
+	mkindex = false           // czy zapisać indeks archiwum (-i)
+)
+
+// Pliki pomijane przez addfile: archiwum, jego plik tymczasowy i plik
+// blokady (patrz setskip).
+var skipfiles []os.FileInfo
+
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: archive -cdptux archname [file ...]\n")
+	fmt.Fprintf(os.Stderr, "usage: archive -cdpstuvx [-C dir] [--force] [-e pat] [-i] [-sum alg] [-z enc] archname [file ...]\n")
+	fmt.Fprintf(os.Stderr, "       archive -export [-e pat] tar|zip archname [file ...]\n")
+	fmt.Fprintf(os.Stderr, "       archive -import [-i] [-sum alg] [-z enc] file archname\n")
 	os.Exit(1)
 }
 
-// getfnames wstawia do fnames nazwy plików podane jako argumenty
-// polecenia archive. Inicjuje fstats. Sprawdza czy nazwy plików się
-// nie powtarzają - jeśli tak, to zwraca error.
-func getfnames() error {
-	fnames = os.Args[3:]
+// getopts czyta opcje występujące w args po parametrze cmd i zwraca
+// pozostałe argumenty (nazwę archiwum i nazwy plików). Opcje -C i
+// --force są dozwolone tylko z parametrem -x, opcje -i, -sum i -z
+// tylko z parametrami -c, -u i -import, a opcja -e (która może
+// wystąpić wielokrotnie) z parametrami -d, -export, -p, -t, -v i -x.
+func getopts(cmd string, args []string) ([]string, error) {
+	for len(args) > 0 {
+		opt := args[0]
+		cmds := "-x" // parametry, z którymi opcja jest dozwolona
+		switch opt {
+		case "-C":
+			if len(args) < 2 {
+				return nil, errors.New("opcja -C wymaga podania katalogu")
+			}
+			destdir = args[1]
+			args = args[2:]
+		case "--force", "-force":
+			force = true
+			args = args[1:]
+		case "-sum":
+			if len(args) < 2 {
+				return nil, errors.New("opcja -sum wymaga podania algorytmu")
+			}
+			sumalg = args[1]
+			if sumalg == "none" {
+				sumalg = ""
+			} else if _, err := header.NewHash(sumalg); err != nil {
+				return nil, fmt.Errorf("opcja -sum: nieznany algorytm: %s", sumalg)
+			}
+			args = args[2:]
+			cmds = "-c -u -import"
+		case "-e":
+			if len(args) < 2 {
+				return nil, errors.New("opcja -e wymaga podania wzorca")
+			}
+			pat, err := pattern.Makepat(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("opcja -e: %s: %v", args[1], err)
+			}
+			epats = append(epats, pat)
+			etexts = append(etexts, args[1])
+			estats = append(estats, false)
+			args = args[2:]
+			cmds = "-d -export -p -t -v -x"
+		case "-i":
+			mkindex = true
+			args = args[1:]
+			cmds = "-c -u -import"
+		case "-z":
+			if len(args) < 2 {
+				return nil, errors.New("opcja -z wymaga podania metody kompresji")
+			}
+			zipalg = args[1]
+			if _, ok := codecs[zipalg]; !ok {
+				return nil, fmt.Errorf("opcja -z: nieznana metoda kompresji: %s", zipalg)
+			}
+			args = args[2:]
+			cmds = "-c -u -import"
+		default:
+			return args, nil
+		}
+		if !strings.Contains(" "+cmds+" ", " "+cmd+" ") {
+			return nil, fmt.Errorf("opcja %s nie dotyczy parametru %s", opt, cmd)
+		}
+	}
+	return args, nil
+}
+
+// getfnames wstawia do fnames nazwy plików names podane jako argumenty
+// polecenia archive. Inicjuje fstats i fglobs. Jeśli globs jest true,
+// to nazwy zawierające znaki specjalne wzorców path.Match są
+// traktowane jako wzorce; niepoprawny wzorzec jest błędem. Sprawdza
+// czy nazwy plików się nie powtarzają - jeśli tak, to zwraca error.
+func getfnames(names []string, globs bool) error {
+	fnames = names
 	fstats = make([]bool, len(fnames))
-	for i := range fstats {
-		fstats[i] = false
+	fglobs = make([]bool, len(fnames))
+	for i, f := range fnames {
+		if globs && isglob(f) {
+			_, err := path.Match(f, "")
+			if err != nil {
+				return fmt.Errorf("%s: %v", f, err)
+			}
+			fglobs[i] = true
+		}
 	}
 
 	// sprawdzenie czy nazwy plików są unikalne
@@ -104,80 +346,71 @@ func getfnames() error {
 	return nil
 }
 
-// update uaktualnia lub dodaje pliki do archiwum. Działa na pliku
-// tymczasowym, który na końcu jest kopiowany do archiwum aname.
-// Jeśli podczas kopiowania archiwum tymczasowego wystąpi błąd, to
-// plik tymczasowy nie jest usuwany i następuje wyjście z programu.
+// update uaktualnia lub dodaje pliki do archiwum aname (patrz
+// rewrite). W przypadku błędu archiwum aname pozostaje niezmienione.
 func update(aname, cmd string) error {
-	t, err := ioutil.TempFile("", tempname)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		t.Close()
-		os.Remove(t.Name())
-	}()
-
-	tw := bufio.NewWriter(t)
-	defer tw.Flush()
-
-	if cmd == "-u" {
-		a, err := os.Open(aname)
-		if err != nil {
-			return err
-		}
-		ar := bufio.NewReader(a)
-		err = replace(ar, tw, "-u")
-		if err != nil {
-			a.Close()
-			return err
-		}
-		a.Close()
-	}
-
-	for i := 0; i < len(fstats); i++ {
-		if fstats[i] == false {
-			err := addfile(fnames[i], tw)
+	return rewrite(aname, func(tw *arch.Writer) error {
+		withindex := mkindex
+		if cmd == "-u" {
+			a, err := os.Open(aname)
 			if err != nil {
 				return err
 			}
-			fstats[i] = true
+			_, ok, err := readindex(a)
+			if err == nil {
+				withindex = withindex || ok
+				err = replace(arch.NewReader(a), tw, "-u")
+			}
+			if err != nil {
+				a.Close()
+				return err
+			}
+			a.Close()
 		}
-	}
 
-	err = tw.Flush()
-	if err != nil {
-		return err
-	}
-
-	err = t.Close()
-	if err != nil {
-		return err
-	}
-
-	err = fcopy(aname, t.Name())
-	if err != nil {
-		// tymczasowe archiwum powinno pozostać, ponieważ archiwum aname
-		// mogło zostać uszkodzone przez błąd podczas fcopy
-		fmt.Fprintf(os.Stderr, "archive: %s\n", err)
-		fmt.Fprintf(os.Stderr, "archive: archiwum tymczasowe: %s\n", t.Name())
-		os.Exit(2) // nie wykonuje defer
-	}
+		for i := 0; i < len(fstats); i++ {
+			if fstats[i] == false {
+				err := addfile(fnames[i], tw)
+				if err != nil {
+					return err
+				}
+				fstats[i] = true
+			}
+		}
 
-	return nil
+		if withindex {
+			return tw.WriteIndex()
+		}
+		return nil
+	})
 }
 
-// table drukuje wykaz zawartości archiwum aname.
+// table drukuje wykaz zawartości archiwum aname. Jeśli archiwum ma
+// indeks, to czytany jest tylko indeks.
 func table(aname string) error {
 	file, err := os.Open(aname)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	br := bufio.NewReader(file) // dla czytania wiersza funkcją ReadString
 
+	index, ok, err := readindex(file)
+	if err != nil {
+		return err
+	}
+	if ok {
+		for _, e := range index {
+			if filearg(e.Header.Name) {
+				tprint(e.Header)
+			}
+		}
+		notfound()
+		return nil
+	}
+
+	tr := arch.NewReader(file)
 	for {
-		hdr, err := header.Read(br)
+		hdr, err := tr.Next()
 		if err == io.EOF {
 			break
 		}
@@ -188,172 +421,512 @@ func table(aname string) error {
 		if filearg(hdr.Name) {
 			tprint(hdr)
 		}
-
-		err = fskip(br, hdr.Size)
-		if err != nil {
-			return err
-		}
 	}
 
 	notfound()
 	return nil
 }
 
-// extract wydobywa pliki z archiwum.
+// extract wydobywa pliki z archiwum. Przy -x odtwarzane są katalogi i
+// dowiązania symboliczne oraz metadane plików zapisane w nagłówkach
+// (prawa dostępu, czas modyfikacji oraz - jeśli program działa z
+// uprawnieniami root - właściciel i grupa). Metadane katalogów są
+// ustawiane na końcu, po wydobyciu ich zawartości.
+//
+// Pliki są wydobywane do katalogu destdir. Nazwy bezwzględne, nazwy
+// zawierające "..", ścieżki prowadzące przez dowiązania symboliczne
+// oraz dowiązania wskazujące poza destdir są odrzucane. Istniejące
+// pliki są zastępowane tylko przy opcji --force.
 func extract(aname, cmd string) error {
 	f, err := os.Open(aname)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	r := bufio.NewReader(f)
 
-	for {
-		hdr, err := header.Read(r)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
+	var dirs []*header.Header // wydobyte katalogi
 
-		if !filearg(hdr.Name) {
-			err := fskip(r, hdr.Size)
-			if err != nil {
-				return err
+	index, ok, err := readindex(f)
+	if err != nil {
+		return err
+	}
+	if ok && hasargs() {
+		// tylko podane pliki - bezpośrednio z pozycji w indeksie
+		for _, e := range index {
+			if !filearg(e.Header.Name) {
+				continue
 			}
-			continue
-		}
-
-		if cmd == "-p" {
-			w := bufio.NewWriter(os.Stdout)
-			err = acopy(w, r, hdr.Size)
+			_, err := f.Seek(e.Offset, io.SeekStart)
 			if err != nil {
-				w.Flush()
 				return err
 			}
-			w.Flush()
-		} else { // "-x"
-			ef, err := os.Create(hdr.Name)
+			tr := arch.NewReader(f)
+			hdr, err := tr.Next()
 			if err != nil {
 				return err
 			}
-			w := bufio.NewWriter(ef)
-
-			err = acopy(w, r, hdr.Size)
+			err = xmember(hdr, tr, cmd, &dirs)
 			if err != nil {
-				w.Flush()
-				ef.Close()
 				return err
 			}
-
-			err = w.Flush()
+		}
+	} else {
+		tr := arch.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
 			if err != nil {
 				return err
 			}
-			err = ef.Close()
+			if !filearg(hdr.Name) {
+				continue
+			}
+			err = xmember(hdr, tr, cmd, &dirs)
 			if err != nil {
 				return err
 			}
 		}
 	}
+
+	// od końca, żeby podkatalogi były przed katalogami nadrzędnymi
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err := setmeta(filepath.Join(destdir, dirs[i].Name), dirs[i])
+		if err != nil {
+			return err
+		}
+	}
 	notfound()
 	return nil
 }
 
-// delete usuwa podane pliki z archiwum.
-func delete(aname string) error {
-	if len(fnames) == 0 {
-		return errors.New("parametr -d wymaga podania nazw plików")
+// xmember wypisuje (cmd == "-p") lub wydobywa (cmd == "-x") plik
+// archiwum o nagłówku hdr, którego zawartość jest czytana z tr.
+// Nagłówki wydobytych katalogów są dodawane do dirs - ich metadane
+// są ustawiane na końcu przez extract.
+func xmember(hdr *header.Header, tr *arch.Reader, cmd string, dirs *[]*header.Header) error {
+	if cmd == "-p" {
+		rc, err := decoder(hdr, tr)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(os.Stdout)
+		_, err = io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			w.Flush()
+			return sumerr(hdr.Name, err)
+		}
+		return w.Flush()
 	}
 
-	t, err := ioutil.TempFile("", tempname)
+	// "-x"
+	path, err := safepath(hdr.Name)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		t.Close()
-		os.Remove(t.Name())
-	}()
+	switch hdr.Type {
+	case header.TypeDir:
+		err = os.MkdirAll(path, 0700)
+		if err != nil {
+			return err
+		}
+		*dirs = append(*dirs, hdr)
+		return nil
+	case header.TypeSymlink:
+		err = xsymlink(path, hdr)
+	default:
+		var rc io.ReadCloser
+		rc, err = decoder(hdr, tr)
+		if err == nil {
+			err = xfile(path, rc)
+			rc.Close()
+		}
+	}
+	if err != nil {
+		return sumerr(hdr.Name, err)
+	}
+	return setmeta(path, hdr)
+}
 
-	tw := bufio.NewWriter(t)
-	defer tw.Flush()
+// readindex czyta indeks archiwum f (patrz arch.ReadIndex) i ustawia
+// f na początek. Zwraca false jeśli archiwum nie ma indeksu.
+func readindex(f *os.File) ([]arch.IndexEntry, bool, error) {
+	index, err := arch.ReadIndex(f)
+	ok := true
+	if err == arch.ErrNoIndex {
+		ok = false
+		err = nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, false, err
+	}
+	return index, ok, nil
+}
 
-	a, err := os.Open(aname)
+// safepath sprawdza czy plik archiwum name może być bezpiecznie
+// wydobyty do katalogu destdir i zwraca jego ścieżkę w destdir. Zwraca
+// błąd jeśli name jest ścieżką bezwzględną, zawiera element "..", lub
+// któryś z jego katalogów nadrzędnych w destdir jest dowiązaniem
+// symbolicznym (które mogłoby wskazywać poza destdir).
+func safepath(name string) (string, error) {
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" ||
+		strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("%s: nazwa jest ścieżką bezwzględną", name)
+	}
+	elems := strings.Split(filepath.ToSlash(name), "/")
+	for _, e := range elems {
+		if e == ".." {
+			return "", fmt.Errorf("%s: nazwa zawiera \"..\"", name)
+		}
+	}
+
+	p := destdir
+	for _, e := range elems[:len(elems)-1] {
+		p = filepath.Join(p, e)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%s: ścieżka prowadzi przez dowiązanie symboliczne %s", name, p)
+		}
+	}
+	return filepath.Join(destdir, name), nil
+}
+
+// prepare przygotowuje utworzenie pliku path: tworzy brakujące
+// katalogi nadrzędne i, przy opcji --force, usuwa istniejący plik (ale
+// nie katalog). Bez opcji --force zwraca błąd jeśli plik istnieje.
+func prepare(path string) error {
+	err := mkparent(path)
 	if err != nil {
 		return err
 	}
-	defer a.Close()
-
-	ar := bufio.NewReader(a)
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !force || fi.IsDir() {
+		return fmt.Errorf("%s: plik istnieje", path)
+	}
+	return os.Remove(path)
+}
 
-	err = replace(ar, tw, "-d")
+// xfile tworzy plik path z zawartością czytaną z r. Plik jest tworzony
+// z flagą O_EXCL, więc nie jest otwierane istniejące dowiązanie
+// symboliczne.
+func xfile(path string, r io.Reader) error {
+	err := prepare(path)
 	if err != nil {
 		return err
 	}
+	ef, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(ef, r)
+	if err != nil {
+		ef.Close()
+		return err
+	}
+	return ef.Close()
+}
 
-	notfound()
+// xsymlink tworzy dowiązanie symboliczne path opisane nagłówkiem hdr.
+// Cel dowiązania nie może być ścieżką bezwzględną ani wskazywać poza
+// katalog destdir. Elementy ".." są dozwolone tylko na początku celu i
+// nie może ich być więcej niż katalogów nadrzędnych dowiązania w
+// destdir. Katalogi nadrzędne dowiązania są zwykłymi katalogami (patrz
+// safepath), a dalsza część celu prowadzi tylko w głąb, także przez
+// inne dowiązania spełniające ten sam warunek - więc łańcuch dowiązań,
+// wydobytych w dowolnej kolejności, nie może wyprowadzić poza destdir.
+func xsymlink(path string, hdr *header.Header) error {
+	link := filepath.FromSlash(hdr.Link)
+	if filepath.IsAbs(link) || filepath.VolumeName(link) != "" ||
+		strings.HasPrefix(hdr.Link, "/") {
+		return fmt.Errorf("%s: dowiązanie do ścieżki bezwzględnej: %s", hdr.Name, hdr.Link)
+	}
+	depth := len(strings.Split(filepath.ToSlash(hdr.Name), "/")) - 1
+	up := 0       // liczba początkowych elementów ".."
+	down := false // czy był już element inny niż ".." i "."
+	for _, e := range strings.Split(filepath.ToSlash(hdr.Link), "/") {
+		switch {
+		case e == "" || e == ".":
+		case e == ".." && !down:
+			up++
+		case e == "..":
+			return fmt.Errorf("%s: element \"..\" w środku celu dowiązania: %s", hdr.Name, hdr.Link)
+		default:
+			down = true
+		}
+	}
+	if up > depth {
+		return fmt.Errorf("%s: dowiązanie wskazuje poza katalog docelowy: %s", hdr.Name, hdr.Link)
+	}
 
-	err = a.Close()
+	err := prepare(path)
 	if err != nil {
 		return err
 	}
+	return os.Symlink(hdr.Link, path)
+}
+
+// mkparent tworzy brakujące katalogi nadrzędne pliku name.
+func mkparent(name string) error {
+	dir := filepath.Dir(name)
+	if dir == "." {
+		return nil
+	}
+	return os.MkdirAll(dir, 0777)
+}
 
-	err = tw.Flush()
+// setmeta ustawia metadane pliku path zapisane w nagłówku hdr.
+// Nagłówki bez metadanych (ze starszych archiwów) są pomijane. Czas
+// modyfikacji i prawa dostępu dowiązań symbolicznych nie są zmieniane.
+func setmeta(path string, hdr *header.Header) error {
+	if hdr.Type == "" {
+		return nil
+	}
+	if os.Geteuid() == 0 {
+		err := os.Lchown(path, hdr.Uid, hdr.Gid)
+		if err != nil {
+			return err
+		}
+	}
+	if hdr.Type == header.TypeSymlink {
+		return nil
+	}
+	err := os.Chmod(path, hdr.Mode)
 	if err != nil {
 		return err
 	}
-	err = t.Close()
+	mtime := time.Unix(hdr.Mtime, 0)
+	return os.Chtimes(path, mtime, mtime)
+}
+
+// verify sprawdza sumy kontrolne plików archiwum aname. Czyta całe
+// archiwum i dla każdego pliku drukuje na stdout wynik sprawdzenia:
+// OK, USZKODZONY lub BRAK SUMY (dla plików bez sumy kontrolnej).
+// Zwraca błąd jeśli któryś plik jest uszkodzony.
+func verify(aname string) error {
+	f, err := os.Open(aname)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+	tr := arch.NewReader(f)
 
-	err = fcopy(aname, t.Name())
-	if err != nil {
-		// tymczasowe archiwum powinno pozostać, ponieważ archiwum aname
-		// mogło zostać uszkodzone przez błąd podczas fcopy
-		fmt.Fprintf(os.Stderr, "archive: %s\n", err)
-		fmt.Fprintf(os.Stderr, "archive: archiwum tymczasowe: %s\n", t.Name())
-		os.Exit(2) // nie wykonuje defer
+	nbad := 0 // liczba uszkodzonych plików
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if !filearg(hdr.Name) {
+			continue
+		}
+
+		_, err = io.Copy(io.Discard, tr)
+		switch {
+		case err == arch.ErrChecksum:
+			fmt.Printf("%s: USZKODZONY\n", hdr.Name)
+			nbad++
+		case err != nil:
+			return err
+		case hdr.Sum == "" && hdr.Size > 0:
+			fmt.Printf("%s: BRAK SUMY\n", hdr.Name)
+		default:
+			fmt.Printf("%s: OK\n", hdr.Name)
+		}
 	}
 
+	notfound()
+	if nbad > 0 {
+		return fmt.Errorf("uszkodzone pliki: %d", nbad)
+	}
 	return nil
 }
 
-// addfile dodaje plik fname na koniec archiwum w.
-func addfile(fname string, w *bufio.Writer) error {
-	defer w.Flush()
+// sumerr dodaje nazwę pliku name do błędu err, jeśli jest to błąd
+// sumy kontrolnej.
+func sumerr(name string, err error) error {
+	if err == arch.ErrChecksum {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return err
+}
+
+// delete usuwa podane pliki z archiwum aname (patrz rewrite).
+func delete(aname string) error {
+	if !hasargs() {
+		return errors.New("parametr -d wymaga podania nazw plików lub wzorców")
+	}
 
-	nf, err := os.Open(fname)
+	return rewrite(aname, func(tw *arch.Writer) error {
+		a, err := os.Open(aname)
+		if err != nil {
+			return err
+		}
+		defer a.Close()
+
+		_, withindex, err := readindex(a)
+		if err != nil {
+			return err
+		}
+		err = replace(arch.NewReader(a), tw, "-d")
+		if err != nil {
+			return err
+		}
+
+		notfound()
+
+		err = a.Close()
+		if err != nil {
+			return err
+		}
+
+		if withindex {
+			return tw.WriteIndex()
+		}
+		return nil
+	})
+}
+
+// addfile dodaje plik fname na koniec archiwum tw. Jeśli fname jest
+// katalogiem, to po jego nagłówku dodawana jest (rekurencyjnie) jego
+// zawartość, w kolejności alfabetycznej. Pliki z skipfiles są
+// pomijane, więc archiwum nie zawiera samego siebie, gdy archiwizowany
+// jest katalog archiwum.
+func addfile(fname string, tw *arch.Writer) error {
+	if skipped(fname) {
+		return nil
+	}
+	hdr, err := addone(fname, tw)
 	if err != nil {
 		return err
 	}
-	defer nf.Close()
+	if hdr.Type == header.TypeDir {
+		entries, err := os.ReadDir(fname)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			err := addfile(filepath.Join(fname, e.Name()), tw)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
+// addone dodaje plik fname na koniec archiwum tw i zwraca jego
+// nagłówek. Dla katalogów i dowiązań symbolicznych zapisywany jest
+// tylko nagłówek.
+func addone(fname string, tw *arch.Writer) (*header.Header, error) {
 	hdr, err := header.New(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	if hdr.Type != header.TypeFile {
+		return hdr, tw.WriteHeader(hdr)
+	}
+
+	nf, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer nf.Close()
+
+	return hdr, addcontent(tw, nf, hdr)
+}
+
+// addcontent zapisuje do archiwum tw nagłówek hdr i zawartość pliku f
+// (ustawionego na początek), skompresowaną metodą zipalg i z sumą
+// kontrolną sumalg, jeśli są ustawione.
+func addcontent(tw *arch.Writer, f *os.File, hdr *header.Header) error {
+	data := f // dane zapisywane w archiwum
+	if zipalg != "" {
+		t, err := compressfile(f, hdr)
+		if err != nil {
+			return err
+		}
+		if t != nil {
+			defer rmtemp(t)
+			data = t
+		}
+	}
+
+	if sumalg != "" {
+		return copysum(tw, data, hdr)
+	}
+	err := tw.WriteHeader(hdr)
 	if err != nil {
 		return err
 	}
+	_, err = io.Copy(tw, data)
+	return err
+}
 
-	err = header.Write(w, hdr)
+// copysum zapisuje zawartość pliku f do archiwum tw, razem z nagłówkiem
+// hdr uzupełnionym o sumę kontrolną. Suma jest obliczana przed
+// zapisaniem nagłówka i ponownie podczas kopiowania - jeśli plik
+// zmienił się w międzyczasie, to zwracany jest błąd.
+func copysum(tw *arch.Writer, f *os.File, hdr *header.Header) error {
+	sum, err := header.Checksum(sumalg, f)
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(w, nf)
+	_, err = f.Seek(0, io.SeekStart)
 	if err != nil {
 		return err
 	}
+	hdr.Sum = sum
 
+	err = tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	hh, err := header.NewHash(sumalg)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, io.TeeReader(f, hh))
+	if err != nil {
+		return err
+	}
+	if header.FormatSum(sumalg, hh) != sum {
+		return fmt.Errorf("%s: plik zmienił się podczas archiwizacji", hdr.Name)
+	}
 	return nil
 }
 
-// replace kopiuje archiwum ar do pliku tymczasowego tw zastępując lub
-// usuwając pliki podane w wywołaniu archive.
-func replace(ar *bufio.Reader, tw *bufio.Writer, cmd string) error {
-	defer tw.Flush()
-
+// replace kopiuje archiwum tr do archiwum tymczasowego tw zastępując
+// lub usuwając pliki podane w wywołaniu archive. Pliki z katalogów
+// podanych w wywołaniu nie są kopiowane - przy -u są dodawane razem z
+// katalogiem przez addfile. Jeśli nie podano nazw plików, to przy -u
+// każdy plik archiwum jest zastępowany osobno (bez zawartości
+// katalogów, która jest w archiwum jako osobne pliki).
+func replace(tr *arch.Reader, tw *arch.Writer, cmd string) error {
 	for {
-		hdr, err := header.Read(ar)
+		hdr, err := tr.Next()
 		if err == io.EOF {
 			return nil
 		}
@@ -362,106 +935,276 @@ func replace(ar *bufio.Reader, tw *bufio.Writer, cmd string) error {
 		}
 
 		if filearg(hdr.Name) {
-			if cmd == "-u" {
-				err := addfile(hdr.Name, tw)
-				if err != nil {
-					return err
-				}
+			var err error
+			switch {
+			case cmd != "-u":
+			case len(fnames) == 0:
+				_, err = addone(hdr.Name, tw)
+			case isfname(hdr.Name):
+				err = addfile(hdr.Name, tw)
 			}
-			err := fskip(ar, hdr.Size)
 			if err != nil {
 				return err
 			}
 		} else {
-			err := header.Write(tw, hdr)
+			err := tw.WriteHeader(hdr)
 			if err != nil {
 				return err
 			}
-			err = acopy(tw, ar, hdr.Size)
+			_, err = io.CopyN(tw, tr, hdr.Size)
 			if err != nil {
-				return err
+				return sumerr(hdr.Name, err)
 			}
 		}
 	}
 }
 
-// fcopy kopiując zawartość pliku src do pliku dst.
-func fcopy(dst, src string) error {
-	fsrc, err := os.Open(src)
+// rewrite zapisuje nową zawartość archiwum aname funkcją fn. Zakłada
+// blokadę archiwum (patrz lock), więc zmiany archiwum są szeregowane.
+// Archiwum jest zapisywane do pliku tymczasowego, który na końcu
+// zastępuje archiwum aname (patrz install); w przypadku błędu archiwum
+// aname pozostaje niezmienione. Archiwum, plik tymczasowy i plik
+// blokady nie są dodawane do archiwum (patrz setskip).
+func rewrite(aname string, fn func(tw *arch.Writer) error) error {
+	lf, err := lock(aname)
 	if err != nil {
 		return err
 	}
-	defer fsrc.Close()
+	defer unlock(lf)
 
-	fdst, err := os.Create(dst)
+	t, err := tempfile(aname)
 	if err != nil {
 		return err
 	}
-	defer fdst.Close()
+	defer func() {
+		// po udanym install plik tymczasowy już nie istnieje
+		t.Close()
+		os.Remove(t.Name())
+	}()
+
+	setskip(aname, t)
 
-	_, err = io.Copy(fdst, fsrc)
+	bw := bufio.NewWriter(t)
+	tw := arch.NewWriter(bw)
+	err = fn(tw)
+	if err != nil {
+		return err
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	err = bw.Flush()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return install(t, aname)
 }
 
-// acopy kopiuje n bajtów z src do dst.
-func acopy(dst *bufio.Writer, src *bufio.Reader, n int64) error {
-	for i := int64(0); i < n; i++ {
-		c, err := src.ReadByte()
-		if err != nil {
-			return fmt.Errorf("błąd podczas acopy: %s", err)
+// tempfile tworzy plik tymczasowy dla nowej zawartości archiwum aname,
+// w katalogu archiwum (żeby Rename w install nie przenosił pliku
+// między systemami plików).
+func tempfile(aname string) (*os.File, error) {
+	dir, base := filepath.Split(aname)
+	if dir == "" {
+		dir = "."
+	}
+	return os.CreateTemp(dir, "."+base+".archive")
+}
+
+// setskip wstawia do skipfiles informacje o archiwum aname, jego pliku
+// tymczasowym t i pliku blokady (patrz lockname). Pliki, które nie
+// istnieją (np. archiwum przy -c), są pomijane.
+func setskip(aname string, t *os.File) {
+	skipfiles = nil
+	for _, name := range []string{aname, t.Name(), lockname(aname)} {
+		fi, err := os.Stat(name)
+		if err == nil {
+			skipfiles = append(skipfiles, fi)
 		}
+	}
+}
 
-		err = dst.WriteByte(c)
-		if err != nil {
-			return fmt.Errorf("błąd podczas acopy: %s", err)
+// skipped sprawdza czy plik fname jest jednym z plików skipfiles
+// (porównując pliki, a nie nazwy - patrz os.SameFile).
+func skipped(fname string) bool {
+	fi, err := os.Lstat(fname)
+	if err != nil {
+		return false
+	}
+	for _, s := range skipfiles {
+		if os.SameFile(fi, s) {
+			return true
 		}
 	}
+	return false
+}
+
+// install atomowo zastępuje archiwum aname plikiem tymczasowym t
+// (utworzonym przez tempfile): synchronizuje t na dysk (fsync), ustawia
+// mu prawa dostępu archiwum (lub 0644 dla nowego archiwum), zamyka go
+// i przemianowuje na aname. Jeśli aname jest dowiązaniem symbolicznym,
+// to zastępowany jest plik wskazywany przez dowiązanie. W przypadku
+// błędu archiwum aname pozostaje niezmienione.
+func install(t *os.File, aname string) error {
+	if p, err := filepath.EvalSymlinks(aname); err == nil {
+		aname = p
+	}
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(aname); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	err := t.Sync()
+	if err != nil {
+		return err
+	}
+	err = t.Chmod(perm)
+	if err != nil {
+		return err
+	}
+	err = t.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(t.Name(), aname)
+	if err != nil {
+		return err
+	}
+	return syncdir(filepath.Dir(aname))
+}
+
+// lockname zwraca nazwę pliku blokady archiwum aname (patrz lock):
+// nazwę archiwum (lub pliku wskazywanego przez dowiązanie) z
+// przyrostkiem ".lock".
+func lockname(aname string) string {
+	if p, err := filepath.EvalSymlinks(aname); err == nil {
+		aname = p
+	}
+	return aname + ".lock"
+}
+
+// syncdir synchronizuje na dysk katalog dir, żeby zmiana nazwy pliku
+// w install była trwała. Błędy systemów nie obsługujących fsync
+// katalogów są pomijane.
+func syncdir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	d.Sync()
 	return nil
 }
 
-// filearg sprawdza czy plik name jest na liście parametrów. Jeśli
-// lista parametrów jest pusta to zwraca zawsze true.
+// filearg sprawdza czy plik name został wybrany argumentami polecenia:
+// jest na liście parametrów, jest zawarty w katalogu z listy
+// parametrów, pasuje do wzorca glob z listy parametrów (patrz globarg)
+// lub do jednego ze wzorców opcji -e. Zaznacza w fstats i estats
+// wszystkie pasujące argumenty. Jeśli nie podano ani nazw plików, ani
+// wzorców, to wybrane są wszystkie pliki.
 func filearg(name string) bool {
-	if len(fnames) == 0 {
+	if !hasargs() {
 		return true
 	}
+	found := false
 	for i, f := range fnames {
-		if name == f {
+		if name == f || indir(name, f) || fglobs[i] && globarg(name, f) {
 			fstats[i] = true
+			found = true
+		}
+	}
+	for i, pat := range epats {
+		if pattern.Match(name+"\n", pat) {
+			estats[i] = true
+			found = true
+		}
+	}
+	return found
+}
+
+// hasargs sprawdza czy podano nazwy plików lub wzorce (-e).
+func hasargs() bool {
+	return len(fnames) > 0 || len(epats) > 0
+}
+
+// isglob sprawdza czy nazwa pliku f zawiera znaki specjalne wzorców
+// path.Match.
+func isglob(f string) bool {
+	return strings.ContainsAny(f, `*?[\`)
+}
+
+// globarg sprawdza czy plik name pasuje do wzorca glob (path.Match)
+// lub jest zawarty w pasującym do niego katalogu. Wzorzec zawierający
+// '/' jest dopasowywany do całej nazwy, a wzorzec bez '/' - do
+// ostatniego elementu nazwy, tak że np. *.go pasuje też do d/a.go.
+func globarg(name, glob string) bool {
+	base := !strings.Contains(glob, "/")
+	for {
+		s := name
+		if base {
+			s = path.Base(name)
+		}
+		ok, _ := path.Match(glob, s)
+		if ok {
+			return true
+		}
+		i := strings.LastIndexByte(name, '/')
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// isfname sprawdza czy name jest jedną z nazw plików na liście
+// parametrów.
+func isfname(name string) bool {
+	for _, f := range fnames {
+		if name == f {
 			return true
 		}
 	}
 	return false
 }
 
-// tprint drukuje na stdout treść nagłówka hdr.
-func tprint(hdr *header.Header) {
-	fmt.Printf("%s %d\n", hdr.Name, hdr.Size)
+// indir sprawdza czy plik name jest zawarty w katalogu dir (na
+// dowolnym poziomie zagnieżdżenia).
+func indir(name, dir string) bool {
+	dir = strings.TrimSuffix(dir, "/")
+	return strings.HasPrefix(name, dir+"/")
 }
 
-// fskip czyta i pomija n bajtów z pliku r.
-func fskip(r *bufio.Reader, n int64) error {
-	for i := int64(0); i < n; i++ {
-		_, err := r.ReadByte()
-		if err != nil {
-			return fmt.Errorf("błąd podczas fskip: %s", err)
-		}
+// tprint drukuje na stdout treść nagłówka hdr: nazwę i rozmiar pliku.
+// Dla plików skompresowanych drukuje rozmiar przed kompresją, a po nim
+// metodę kompresji i rozmiar w archiwum, np.: a.txt 1234 (rle 567).
+func tprint(hdr *header.Header) {
+	if hdr.Enc != "" {
+		fmt.Printf("%s %d (%s %d)\n", hdr.Name, hdr.Usize, hdr.Enc, hdr.Size)
+		return
 	}
-	return nil
+	fmt.Printf("%s %d\n", hdr.Name, hdr.Size)
 }
 
 // notfound drukuje info o plikach występujących w liście parametrów
-// ale nie znalezionych w archiwum.
+// ale nie znalezionych w archiwum oraz o wzorcach (glob i -e), do
+// których nie pasuje żaden plik archiwum.
 func notfound() {
 	for i, f := range fnames {
-		if fstats[i] == false {
+		switch {
+		case fstats[i]:
+		case fglobs[i]:
+			fmt.Fprintf(os.Stderr, "%s: nie pasuje do żadnego pliku w archiwum\n", f)
+		default:
 			fmt.Fprintf(os.Stderr, "%s: nie ma w archiwum\n", f)
 		}
 	}
+	for i, e := range etexts {
+		if !estats[i] {
+			fmt.Fprintf(os.Stderr, "-e %s: nie pasuje do żadnego pliku w archiwum\n", e)
+		}
+	}
 }
 
 func main() {
@@ -473,15 +1216,58 @@ func main() {
 	}
 
 	cmd := os.Args[1]
-	aname := os.Args[2]
-	err := getfnames()
+	args, err := getopts(cmd, os.Args[2:])
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	switch cmd {
-	case "-c", "-u":
-		err := update(aname, cmd)
+	case "-export":
+		// archive -export format aname [file ...]
+		if len(args) < 2 {
+			usage()
+		}
+		err = getfnames(args[2:], true)
+		if err == nil {
+			w := bufio.NewWriter(os.Stdout)
+			err = export(args[1], args[0], w)
+			if err == nil {
+				err = w.Flush()
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "-import":
+		// archive -import src aname
+		if len(args) != 2 {
+			usage()
+		}
+		err = importarch(args[0], args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(args) < 1 {
+		usage()
+	}
+	aname := args[0]
+	// przy -c, -u i -s argumenty są nazwami plików, a nie wzorcami
+	err = getfnames(args[1:], cmd != "-c" && cmd != "-u" && cmd != "-s")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch cmd {
+	case "-c", "-u", "-d":
+		if cmd == "-d" {
+			err = delete(aname)
+		} else {
+			err = update(aname, cmd)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -495,8 +1281,13 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
-	case "-d":
-		err := delete(aname)
+	case "-v":
+		err := verify(aname)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "-s":
+		err := status(aname, os.Stdout)
 		if err != nil {
 			log.Fatal(err)
 		}
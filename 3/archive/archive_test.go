@@ -0,0 +1,663 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adbr/npwp/3/archive/arch"
+	"github.com/adbr/npwp/3/archive/header"
+)
+
+func TestSafepath(t *testing.T) {
+	destdir = t.TempDir()
+	defer func() { destdir = "." }()
+	err := os.Symlink(os.TempDir(), filepath.Join(destdir, "l"))
+	if err != nil {
+		t.Skip(err)
+	}
+
+	type test struct {
+		name string // nazwa pliku w archiwum
+		e    bool   // czy powinien wystąpić błąd
+	}
+	tests := []test{
+		{"a", false},
+		{"d/e/a", false},
+		{"./a", false},
+		{"a..b", false},
+		{"l", false}, // samo dowiązanie może być zastąpione (--force)
+		{"/etc/passwd", true},
+		{"../a", true},
+		{"d/../../a", true},
+		{"d/..", true},
+		{"l/a", true},
+		{"l/d/a", true},
+	}
+
+	for i, tc := range tests {
+		_, err := safepath(tc.name)
+		if tc.e && err == nil {
+			t.Errorf("#%d: %q: powinien wystąpić błąd", i, tc.name)
+		}
+		if !tc.e && err != nil {
+			t.Errorf("#%d: %q: %s", i, tc.name, err)
+		}
+	}
+}
+
+func TestXsymlink(t *testing.T) {
+	destdir = t.TempDir()
+	defer func() { destdir = "." }()
+
+	type test struct {
+		name string // nazwa dowiązania
+		link string // cel dowiązania
+		e    bool   // czy powinien wystąpić błąd
+	}
+	tests := []test{
+		{"a", "b", false},
+		{"d/a", "../b", false},
+		{"d/e/a", "../../d/b", false},
+		{"b", "/etc/passwd", true},
+		{"c", "..", true},
+		{"d/c", "../../b", true},
+		{"d/f", "e/../../..", true},
+		{"d/g", "./../b", false},
+		// łańcuch dowiązań: sub/l2/.. wskazywałoby na katalog
+		// nadrzędny destdir, niezależnie od kolejności wydobycia
+		{"l0", "sub/l2/..", true},
+		{"sub/l2", "..", false},
+		{"l1", "sub/l2/..", true},
+		{"l3", "sub/l2/x", false},
+	}
+
+	for i, tc := range tests {
+		hdr := &header.Header{
+			Mark: "-h-",
+			Name: tc.name,
+			Type: header.TypeSymlink,
+			Link: tc.link,
+		}
+		err := xsymlink(filepath.Join(destdir, tc.name), hdr)
+		if tc.e && err == nil {
+			t.Errorf("#%d: %q -> %q: powinien wystąpić błąd", i, tc.name, tc.link)
+		}
+		if !tc.e && err != nil {
+			t.Errorf("#%d: %q -> %q: %s", i, tc.name, tc.link, err)
+		}
+	}
+}
+
+func TestCodec(t *testing.T) {
+	defer func() { zipalg = "" }()
+	zipalg = "rle"
+
+	tests := []struct {
+		data string // zawartość pliku
+		enc  bool   // czy plik powinien być skompresowany
+	}{
+		{"", false},
+		{"abc\n", false},
+		{strings.Repeat("a", 100) + "\n" + strings.Repeat("~", 30), true},
+		{strings.Repeat("\xff", 50) + "\x00\x01", true},
+	}
+
+	for i, tc := range tests {
+		name := filepath.Join(t.TempDir(), "f")
+		err := os.WriteFile(name, []byte(tc.data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hdr, err := header.New(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := compressfile(f, hdr)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if (c != nil) != tc.enc || (hdr.Enc != "") != tc.enc {
+			t.Errorf("#%d: oczekiwano kompresji: %v, jest: %v", i, tc.enc, hdr.Enc)
+		}
+		if c == nil {
+			c = f
+		}
+
+		rc, err := decoder(hdr, c)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+		}
+		if string(data) != tc.data {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, tc.data, data)
+		}
+		rc.Close()
+		if c != f {
+			rmtemp(c)
+		}
+		f.Close()
+	}
+
+	// zły rozmiar po dekompresji
+	hdr := &header.Header{Mark: "-h-", Name: "a", Size: 3, Enc: "rle", Usize: 5}
+	rc, err := decoder(hdr, strings.NewReader("~Da"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(rc)
+	if err == nil {
+		t.Error("powinien wystąpić błąd rozmiaru")
+	}
+
+	// Po Close dekompresja nie może już czytać z r, który jest dalej
+	// czytany przez wywołującego (jak arch.Reader przez Next) - wykrywa
+	// to go test -race.
+	data := strings.Repeat("abcdefgh", 32*1024)
+	r := strings.NewReader(data)
+	hdr = &header.Header{Mark: "-h-", Name: "a", Size: int64(len(data)), Enc: "rle", Usize: int64(len(data))}
+	rc, err = decoder(hdr, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadFull(rc, make([]byte, 4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	_, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	aname := filepath.Join(t.TempDir(), "a")
+	err := os.WriteFile(aname, []byte("old"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := lock(aname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock(lf)
+
+	f, err := tempfile(aname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(f.Name()) != filepath.Dir(aname) {
+		t.Errorf("plik tymczasowy poza katalogiem archiwum: %s", f.Name())
+	}
+	_, err = f.WriteString("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = install(f, aname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(aname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new" {
+		t.Errorf("oczekiwano: %q, jest: %q", "new", data)
+	}
+	fi, err := os.Stat(aname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("oczekiwano praw dostępu 0600, jest: %#o", fi.Mode().Perm())
+	}
+	_, err = os.Stat(f.Name())
+	if !os.IsNotExist(err) {
+		t.Errorf("plik tymczasowy nie został przemianowany: %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	aname := filepath.Join(t.TempDir(), "a")
+
+	lf, err := lock(aname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// druga blokada czeka, dopóki pierwsza nie zostanie zwolniona
+	locked := make(chan error)
+	go func() {
+		lf, err := lock(aname)
+		if err == nil {
+			unlock(lf)
+		}
+		locked <- err
+	}()
+	select {
+	case err := <-locked:
+		t.Fatalf("druga blokada założona mimo pierwszej: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	unlock(lf)
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("druga blokada nie została założona po zwolnieniu pierwszej")
+	}
+}
+
+func TestSkipArchive(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer func() {
+		fnames, fstats, fglobs = nil, nil, nil
+		skipfiles = nil
+	}()
+
+	err := os.Mkdir("d", 0755)
+	if err == nil {
+		err = os.WriteFile("d/a", []byte("a\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// archiwum jest w archiwizowanym katalogu, najpierw tworzone, a
+	// potem uaktualniane
+	aname := filepath.Join("d", "x.arc")
+	for _, cmd := range []string{"-c", "-u"} {
+		err := getfnames([]string{"d"}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = update(aname, cmd)
+		if err != nil {
+			t.Fatalf("%s: %s", cmd, err)
+		}
+
+		f, err := os.Open(aname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		tr := arch.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, hdr.Name)
+		}
+		f.Close()
+		want := "d d/a"
+		if strings.Join(names, " ") != want {
+			t.Errorf("%s: oczekiwano: %q, jest: %q", cmd, want, strings.Join(names, " "))
+		}
+	}
+}
+
+func TestFilearg(t *testing.T) {
+	defer func() {
+		fnames, fstats, fglobs = nil, nil, nil
+		epats, etexts, estats = nil, nil, nil
+	}()
+
+	type test struct {
+		args  []string // nazwy plików lub wzorce glob
+		epats []string // wzorce opcji -e
+		name  string   // nazwa pliku w archiwum
+		ok    bool     // czy plik powinien być wybrany
+	}
+	tests := []test{
+		{nil, nil, "a.go", true},
+		{[]string{"a.go"}, nil, "a.go", true},
+		{[]string{"a.go"}, nil, "b.go", false},
+		{[]string{"d"}, nil, "d/a.go", true},
+		{[]string{"*.go"}, nil, "a.go", true},
+		{[]string{"*.go"}, nil, "d/e/a.go", true},
+		{[]string{"*.go"}, nil, "a.txt", false},
+		{[]string{"d/*.go"}, nil, "d/a.go", true},
+		{[]string{"d/*.go"}, nil, "e/d/a.go", false},
+		{[]string{"d?"}, nil, "d1/e/a.txt", true},
+		{[]string{"[ab].txt"}, nil, "c.txt", false},
+		{[]string{`\*`}, nil, "*", true},
+		{nil, []string{`.go$`}, "d/a.go", true},
+		{nil, []string{`.go$`}, "a.go.txt", false},
+		{nil, []string{`%d/`}, "d/a", true},
+		{nil, []string{`%d/`}, "e/d/a", false},
+		{[]string{"a.txt"}, []string{"go"}, "a.go", true},
+	}
+
+	for i, tc := range tests {
+		epats, etexts, estats = nil, nil, nil
+		opts := []string{}
+		for _, e := range tc.epats {
+			opts = append(opts, "-e", e)
+		}
+		_, err := getopts("-x", append(opts, "arch"))
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		err = getfnames(tc.args, true)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		ok := filearg(tc.name)
+		if ok != tc.ok {
+			t.Errorf("#%d: %q: oczekiwano: %v, jest: %v", i, tc.name, tc.ok, ok)
+		}
+	}
+}
+
+func TestGetfnamesGlob(t *testing.T) {
+	defer func() { fnames, fstats, fglobs = nil, nil, nil }()
+
+	err := getfnames([]string{"[a"}, true)
+	if err == nil {
+		t.Errorf("niepoprawny wzorzec: powinien wystąpić błąd")
+	}
+	err = getfnames([]string{"[a"}, false)
+	if err != nil {
+		t.Errorf("nazwa pliku: %s", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	aname := filepath.Join(dir, "a")
+	hdrs := []*header.Header{
+		{Mark: "-h-", Name: "d", Type: header.TypeDir, Mode: 0755, Mtime: 1412345678},
+		{Mark: "-h-", Name: "d/f", Size: 4, Type: header.TypeFile, Mode: 0640, Mtime: 1412345679, Uid: 1, Gid: 2},
+		{Mark: "-h-", Name: "l", Type: header.TypeSymlink, Mode: 0777, Mtime: 1412345680, Link: "d/f"},
+		{Mark: "-h-", Name: "old", Size: 1},
+	}
+	data := map[string]string{"d/f": "abc\n", "old": "x"}
+
+	var buf bytes.Buffer
+	tw := arch.NewWriter(&buf)
+	for _, h := range hdrs {
+		err := tw.WriteHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.WriteString(tw, data[h.Name])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.WriteFile(aname, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"tar", "zip"} {
+		src := filepath.Join(dir, "a."+format)
+		f, err := os.Create(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = export(aname, format, f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		bname := filepath.Join(dir, "b")
+		err = importarch(src, bname)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		b, err := os.Open(bname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := arch.NewReader(b)
+		for i, want := range hdrs {
+			hdr, err := tr.Next()
+			if err != nil {
+				t.Fatalf("%s: #%d: %s", format, i, err)
+			}
+			s, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("%s: #%d: %s", format, i, err)
+			}
+			if hdr.Name != want.Name || hdr.Size != want.Size ||
+				string(s) != data[want.Name] || hdr.Link != want.Link {
+				t.Errorf("%s: #%d: oczekiwano: %q, jest: %q", format, i, want, hdr)
+			}
+			if want.Type != "" && (hdr.Type != want.Type ||
+				hdr.Mode != want.Mode || hdr.Mtime != want.Mtime) {
+				t.Errorf("%s: #%d: oczekiwano: %q, jest: %q", format, i, want, hdr)
+			}
+			if format == "tar" && (hdr.Uid != want.Uid || hdr.Gid != want.Gid) {
+				t.Errorf("%s: #%d: oczekiwano: %q, jest: %q", format, i, want, hdr)
+			}
+		}
+		_, err = tr.Next()
+		if err != io.EOF {
+			t.Errorf("%s: oczekiwano: %v, jest: %v", format, io.EOF, err)
+		}
+		b.Close()
+	}
+}
+
+func TestDiff(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer func() {
+		fnames, fstats, fglobs = nil, nil, nil
+		sumalg, zipalg = header.SumCRC32, ""
+	}()
+
+	files := map[string]string{
+		"a": "aaaaaaaaaa\n",
+		"b": "bbbbbbbbbb\n",
+		"c": "cccccccccc\n",
+		"d": "dddddddddd\n",
+		"e": "eeeeeeeeee\n",
+	}
+	for name, data := range files {
+		err := os.WriteFile(name, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.Symlink("a", "l")
+	if err != nil {
+		t.Skip(err)
+	}
+	names := []string{"a", "b", "c", "d", "e", "l"}
+
+	// oczekiwany wynik diff po zmianie plików
+	want := map[string]string{
+		"a": "",
+		"b": "ZMIENIONY: zawartość",
+		"c": "ZMIENIONY: rozmiar",
+		"d": "ZMIENIONY: prawa dostępu",
+		"e": "BRAK NA DYSKU",
+		"l": "ZMIENIONY: cel dowiązania",
+	}
+
+	type test struct {
+		sumalg string // algorytm sum kontrolnych
+		zipalg string // metoda kompresji
+	}
+	tests := []test{
+		{header.SumCRC32, ""},
+		{"", ""},
+		{header.SumSHA256, "rle"},
+	}
+
+	for i, tc := range tests {
+		sumalg, zipalg = tc.sumalg, tc.zipalg
+		err := os.WriteFile("b", []byte(files["b"]), 0644)
+		if err == nil {
+			err = os.WriteFile("c", []byte(files["c"]), 0644)
+		}
+		if err == nil {
+			err = os.WriteFile("e", []byte(files["e"]), 0644)
+		}
+		if err == nil {
+			err = os.Chmod("d", 0644)
+		}
+		if err == nil {
+			os.Remove("l")
+			err = os.Symlink("a", "l")
+		}
+		if err == nil {
+			err = getfnames(names, false)
+		}
+		if err == nil {
+			err = update("arch", "-c")
+		}
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+
+		// zmiany plików
+		err = os.WriteFile("b", []byte("bbbbbbbbbx\n"), 0644)
+		if err == nil {
+			err = os.WriteFile("c", []byte("c\n"), 0644)
+		}
+		if err == nil {
+			err = os.Chmod("d", 0600)
+		}
+		if err == nil {
+			err = os.Remove("e")
+		}
+		if err == nil {
+			os.Remove("l")
+			err = os.Symlink("b", "l")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open("arch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := arch.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("#%d: %s", i, err)
+			}
+			st, err := diff(hdr, tr)
+			if err != nil {
+				t.Fatalf("#%d: %s: %s", i, hdr.Name, err)
+			}
+			if st != want[hdr.Name] {
+				t.Errorf("#%d: %s: oczekiwano: %q, jest: %q", i, hdr.Name, want[hdr.Name], st)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestStatus(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer func() {
+		fnames, fstats, fglobs = nil, nil, nil
+		sumalg, zipalg = header.SumCRC32, ""
+	}()
+
+	// Plik a jest skompresowany i porównywany bajt po bajcie; różni
+	// się na początku, więc porównanie kończy się przed końcem jego
+	// zawartości w archiwum, a następne pliki są czytane po
+	// przerwaniu dekompresji.
+	big := strings.Repeat("aaaaaaaaaaaaaaaa bbbbbbbbbbbbbbbb\n", 10000)
+	files := map[string]string{
+		"a": big,
+		"b": big,
+		"c": "c\n",
+	}
+	for name, data := range files {
+		err := os.WriteFile(name, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sumalg, zipalg = header.SumCRC32, "rle"
+	err := getfnames([]string{"a", "b", "c"}, false)
+	if err == nil {
+		err = update("arch", "-c")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile("a", []byte("x"+big[1:]), 0644)
+	if err == nil {
+		err = os.WriteFile("d", []byte("d\n"), 0644)
+	}
+	if err == nil {
+		err = getfnames([]string{"a", "b", "c", "d"}, false)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = status("arch", &buf)
+	if err == nil {
+		t.Error("powinien wystąpić błąd różnic")
+	}
+	want := "a: ZMIENIONY: zawartość\nd: NOWY\n"
+	if buf.String() != want {
+		t.Errorf("oczekiwano: %q, jest: %q", want, buf.String())
+	}
+}
+
+func TestEqual(t *testing.T) {
+	type test struct {
+		s1 string
+		s2 string
+		eq bool
+	}
+	long := strings.Repeat("x", 100000)
+	tests := []test{
+		{"", "", true},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "ab", false},
+		{"", "a", false},
+		{long, long, true},
+		{long, long + "y", false},
+		{long + "y", long + "z", false},
+	}
+
+	for i, tc := range tests {
+		eq, err := equal(strings.NewReader(tc.s1), strings.NewReader(tc.s2))
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if eq != tc.eq {
+			t.Errorf("#%d: oczekiwano: %v, jest: %v", i, tc.eq, eq)
+		}
+	}
+}
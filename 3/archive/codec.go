@@ -0,0 +1,150 @@
+// Plik zawiera funkcjonalność związaną z kompresją plików w archiwum
+// (opcja -z).
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/adbr/npwp/2/compress/rle"
+	"github.com/adbr/npwp/3/archive/header"
+)
+
+// Typ codec zawiera funkcje kompresji i dekompresji danych jedną
+// metodą.
+type codec struct {
+	compress func(w io.Writer, r io.Reader) error
+	expand   func(w io.Writer, r io.Reader) error
+}
+
+// codecs zawiera metody kompresji dostępne w opcji -z, według nazw
+// zapisywanych w polu enc nagłówka.
+var codecs = map[string]codec{
+	"rle": {rle.Compress, rle.Expand},
+}
+
+// countWriter zlicza bajty zapisywane do w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// compressfile kompresuje zawartość pliku f metodą zipalg do pliku
+// tymczasowego i uzupełnia nagłówek hdr o pola Enc i Usize. Zwraca
+// plik tymczasowy ustawiony na początek, który należy zamknąć i usunąć
+// (funkcją rmtemp). Jeśli skompresowane dane nie są krótsze od
+// oryginału, to zwraca nil, nagłówek nie jest zmieniany, a f jest
+// ustawiany na początek.
+func compressfile(f *os.File, hdr *header.Header) (*os.File, error) {
+	c, ok := codecs[zipalg]
+	if !ok {
+		return nil, fmt.Errorf("nieznana metoda kompresji: %s", zipalg)
+	}
+
+	t, err := os.CreateTemp("", tempname)
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(t)
+	cr := &countReader{r: f}
+	err = c.compress(bw, cr)
+	if err == nil {
+		err = bw.Flush()
+	}
+	var size int64
+	if err == nil {
+		size, err = t.Seek(0, io.SeekCurrent)
+	}
+	if err != nil {
+		rmtemp(t)
+		return nil, err
+	}
+
+	if size >= cr.n {
+		rmtemp(t)
+		_, err = f.Seek(0, io.SeekStart)
+		return nil, err
+	}
+	_, err = t.Seek(0, io.SeekStart)
+	if err != nil {
+		rmtemp(t)
+		return nil, err
+	}
+	hdr.Enc = zipalg
+	hdr.Usize = cr.n
+	hdr.Size = size
+	return t, nil
+}
+
+// countReader zlicza bajty czytane z r.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countReader) Read(b []byte) (int, error) {
+	n, err := cr.r.Read(b)
+	cr.n += int64(n)
+	return n, err
+}
+
+// rmtemp zamyka i usuwa plik tymczasowy t.
+func rmtemp(t *os.File) {
+	t.Close()
+	os.Remove(t.Name())
+}
+
+// decoder zwraca reader udostępniający zawartość pliku archiwum o
+// nagłówku hdr, czytaną z r i zdekompresowaną metodą z pola Enc. Dla
+// plików nieskompresowanych zwraca r. Jeśli rozmiar danych po
+// dekompresji jest inny niż Usize, to ostatni Read zwraca błąd.
+// Zwrócony reader należy zamknąć - dopiero po zamknięciu można dalej
+// czytać z r (np. następny plik archiwum).
+func decoder(hdr *header.Header, r io.Reader) (io.ReadCloser, error) {
+	if hdr.Enc == "" {
+		return io.NopCloser(r), nil
+	}
+	c, ok := codecs[hdr.Enc]
+	if !ok {
+		return nil, fmt.Errorf("%s: nieznana metoda kompresji: %s", hdr.Name, hdr.Enc)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cw := &countWriter{w: pw}
+		err := c.expand(cw, r)
+		if err == nil && cw.n != hdr.Usize {
+			err = fmt.Errorf("%s: zły rozmiar po dekompresji: %d zamiast %d",
+				hdr.Name, cw.n, hdr.Usize)
+		}
+		pw.CloseWithError(err)
+	}()
+	return &pipeDecoder{pr, done}, nil
+}
+
+// pipeDecoder jest readerem zwracanym przez decoder dla plików
+// skompresowanych. Dekompresja działa w osobnej gorutynie, która pisze
+// do potoku - zamknięcie potoku przerywa ją przy następnym zapisie.
+type pipeDecoder struct {
+	*io.PipeReader
+	done chan struct{} // zamykany po zakończeniu gorutyny
+}
+
+// Close zamyka potok i czeka na zakończenie gorutyny dekompresji, żeby
+// po powrocie nie czytała już z readera archiwum.
+func (d *pipeDecoder) Close() error {
+	err := d.PipeReader.Close()
+	<-d.done
+	return err
+}
@@ -0,0 +1,353 @@
+// Plik zawiera funkcjonalność związaną z konwersją archiwum do i z
+// formatów tar i zip (parametry -export i -import).
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adbr/npwp/3/archive/arch"
+	"github.com/adbr/npwp/3/archive/header"
+)
+
+// zipmagic zawiera możliwe początki pliku w formacie zip: nagłówek
+// pierwszego pliku lub (w pustym archiwum) koniec katalogu.
+var zipmagic = []string{"PK\x03\x04", "PK\x05\x06"}
+
+// export zapisuje do w wybrane pliki archiwum aname (patrz filearg) w
+// formacie format: tar lub zip. Pliki skompresowane są zapisywane po
+// dekompresji. Metadane są przenoszone w miarę możliwości: format zip
+// nie zawiera właściciela i grupy pliku, a dowiązania symboliczne
+// zapisuje jako pliki zawierające cel dowiązania (jak program zip).
+func export(aname, format string, w io.Writer) error {
+	var (
+		put    func(hdr *header.Header, r io.Reader) error
+		finish func() error
+	)
+	switch format {
+	case "tar":
+		tw := tar.NewWriter(w)
+		put = func(hdr *header.Header, r io.Reader) error {
+			return puttar(tw, hdr, r)
+		}
+		finish = tw.Close
+	case "zip":
+		zw := zip.NewWriter(w)
+		put = func(hdr *header.Header, r io.Reader) error {
+			return putzip(zw, hdr, r)
+		}
+		finish = zw.Close
+	default:
+		return fmt.Errorf("-export: nieznany format: %s", format)
+	}
+
+	f, err := os.Open(aname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := arch.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !filearg(hdr.Name) {
+			continue
+		}
+
+		rc, err := decoder(hdr, tr)
+		if err != nil {
+			return err
+		}
+		err = put(hdr, rc)
+		rc.Close()
+		if err != nil {
+			return sumerr(hdr.Name, err)
+		}
+	}
+
+	err = finish()
+	if err != nil {
+		return err
+	}
+	notfound()
+	return nil
+}
+
+// puttar zapisuje do archiwum tar tw plik o nagłówku hdr i zawartości
+// czytanej z r. Nazwy katalogów są zakończone znakiem '/'.
+func puttar(tw *tar.Writer, hdr *header.Header, r io.Reader) error {
+	th := &tar.Header{
+		Name:    hdr.Name,
+		Mode:    int64(hdr.Mode),
+		Uid:     hdr.Uid,
+		Gid:     hdr.Gid,
+		ModTime: time.Unix(hdr.Mtime, 0),
+	}
+	switch hdr.Type {
+	case header.TypeDir:
+		th.Typeflag = tar.TypeDir
+		th.Name += "/"
+	case header.TypeSymlink:
+		th.Typeflag = tar.TypeSymlink
+		th.Linkname = hdr.Link
+	default:
+		th.Typeflag = tar.TypeReg
+		th.Size = datasize(hdr)
+		if hdr.Type == "" {
+			// nagłówek bez metadanych (starsze archiwum)
+			th.Mode = 0644
+		}
+	}
+
+	err := tw.WriteHeader(th)
+	if err != nil {
+		return err
+	}
+	if th.Typeflag == tar.TypeReg {
+		_, err = io.Copy(tw, r)
+	}
+	return err
+}
+
+// putzip zapisuje do archiwum zip zw plik o nagłówku hdr i zawartości
+// czytanej z r. Nazwy katalogów są zakończone znakiem '/'.
+func putzip(zw *zip.Writer, hdr *header.Header, r io.Reader) error {
+	fh := &zip.FileHeader{
+		Name:     hdr.Name,
+		Method:   zip.Deflate,
+		Modified: time.Unix(hdr.Mtime, 0),
+	}
+	mode := hdr.Mode
+	switch hdr.Type {
+	case header.TypeDir:
+		fh.Name += "/"
+		fh.Method = zip.Store
+		mode |= os.ModeDir
+	case header.TypeSymlink:
+		mode |= os.ModeSymlink
+		r = strings.NewReader(hdr.Link)
+	case "":
+		mode = 0644
+	}
+	fh.SetMode(mode)
+
+	w, err := zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// datasize zwraca rozmiar zawartości pliku o nagłówku hdr po
+// dekompresji.
+func datasize(hdr *header.Header) int64 {
+	if hdr.Enc != "" {
+		return hdr.Usize
+	}
+	return hdr.Size
+}
+
+// importarch tworzy archiwum aname zawierające pliki z archiwum src w
+// formacie tar lub zip (rozpoznawanym po zawartości pliku). Pliki są
+// zapisywane tak jak przy -c: z sumami kontrolnymi (-sum), kompresją
+// (-z) i indeksem (-i). Pliki, których nie można zapisać w archiwum
+// (np. pliki urządzeń, dowiązania twarde), są pomijane z ostrzeżeniem.
+// Tak jak update zapisuje archiwum funkcją rewrite.
+func importarch(src, aname string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	iszip, err := iszipfile(f)
+	if err != nil {
+		return err
+	}
+
+	return rewrite(aname, func(tw *arch.Writer) error {
+		var err error
+		if iszip {
+			err = importzip(f, tw)
+		} else {
+			err = importtar(f, tw)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", src, err)
+		}
+
+		if mkindex {
+			return tw.WriteIndex()
+		}
+		return nil
+	})
+}
+
+// iszipfile sprawdza czy plik f jest w formacie zip. Ustawia f na
+// początek.
+func iszipfile(f *os.File) (bool, error) {
+	b := make([]byte, 4)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range zipmagic {
+		if bytes.Equal(b[:n], []byte(m)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// importtar zapisuje do archiwum tw pliki z archiwum tar czytanego z r.
+func importtar(r io.Reader, tw *arch.Writer) error {
+	tr := tar.NewReader(r)
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		hdr := &header.Header{
+			Mark:  "-h-",
+			Name:  strings.TrimSuffix(th.Name, "/"),
+			Mode:  os.FileMode(th.Mode).Perm(),
+			Mtime: th.ModTime.Unix(),
+			Uid:   th.Uid,
+			Gid:   th.Gid,
+		}
+		switch th.Typeflag {
+		case tar.TypeReg:
+			hdr.Type = header.TypeFile
+		case tar.TypeDir:
+			hdr.Type = header.TypeDir
+		case tar.TypeSymlink:
+			hdr.Type = header.TypeSymlink
+			hdr.Link = th.Linkname
+		default:
+			warnskip(th.Name, fmt.Sprintf("nieobsługiwany rodzaj pliku tar: %q", th.Typeflag))
+			continue
+		}
+		err = importmember(tw, hdr, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// importzip zapisuje do archiwum tw pliki z archiwum zip f. Format zip
+// nie zawiera właściciela i grupy pliku - są ustawiane na 0.
+func importzip(f *os.File, tw *arch.Writer) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		hdr := &header.Header{
+			Mark: "-h-",
+			Name: strings.TrimSuffix(zf.Name, "/"),
+			Mode: mode.Perm(),
+		}
+		if !zf.Modified.IsZero() {
+			hdr.Mtime = zf.Modified.Unix()
+		}
+		switch {
+		case mode.IsRegular():
+			hdr.Type = header.TypeFile
+		case mode.IsDir():
+			hdr.Type = header.TypeDir
+		case mode&os.ModeSymlink != 0:
+			hdr.Type = header.TypeSymlink
+		default:
+			warnskip(zf.Name, fmt.Sprintf("nieobsługiwany rodzaj pliku zip: %s", mode.Type()))
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		if hdr.Type == header.TypeSymlink {
+			// zawartością pliku jest cel dowiązania
+			var b []byte
+			b, err = io.ReadAll(rc)
+			hdr.Link = string(b)
+		}
+		if err == nil {
+			err = importmember(tw, hdr, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importmember zapisuje do archiwum tw plik o nagłówku hdr i zawartości
+// czytanej z r (tylko dla zwykłych plików). Zawartość jest kopiowana do
+// pliku tymczasowego, żeby można było obliczyć sumę kontrolną i
+// skompresować ją przed zapisaniem nagłówka (patrz addcontent). Plik o
+// nazwie, której nie można zapisać w nagłówku, jest pomijany z
+// ostrzeżeniem.
+func importmember(tw *arch.Writer, hdr *header.Header, r io.Reader) error {
+	err := header.CheckName(hdr.Name)
+	if err == nil && hdr.Link != "" {
+		err = header.CheckName(hdr.Link)
+	}
+	if err != nil {
+		warnskip(hdr.Name, err.Error())
+		return nil
+	}
+
+	if hdr.Type != header.TypeFile {
+		return tw.WriteHeader(hdr)
+	}
+
+	t, err := os.CreateTemp("", tempname)
+	if err != nil {
+		return err
+	}
+	defer rmtemp(t)
+	hdr.Size, err = io.Copy(t, r)
+	if err != nil {
+		return err
+	}
+	_, err = t.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	return addcontent(tw, t, hdr)
+}
+
+// warnskip drukuje ostrzeżenie o pominięciu pliku name z powodu why.
+func warnskip(name, why string) {
+	fmt.Fprintf(os.Stderr, "archive: %q: pominięty: %s\n", name, why)
+}
@@ -11,39 +11,178 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
 	hdrmark = "-h-" // string oznaczający początek nagłówka
 )
 
-// Header zawiera informacje o pliku zawarte w jego nagłówku.
+// Rodzaje plików zapisywane w polu type nagłówka.
+const (
+	TypeFile    = "file"    // zwykły plik
+	TypeDir     = "dir"     // katalog
+	TypeSymlink = "symlink" // dowiązanie symboliczne
+	TypeIndex   = "index"   // indeks archiwum (patrz pakiet arch)
+)
+
+// Header zawiera informacje o pliku zawarte w jego nagłówku. Pola od
+// Type do Link są opcjonalne - są zapisywane w nagłówku tylko jeśli
+// Type nie jest pusty. Nagłówki bez tych pól (np. ze starszych
+// archiwów) opisują zwykłe pliki bez metadanych. Pola Enc, Usize i
+// Sum są opcjonalne i zapisywane tylko jeśli Enc lub Sum nie są puste.
+// Dla plików skompresowanych Size jest rozmiarem danych zapisanych w
+// archiwum, a Usize rozmiarem pliku po dekompresji.
 type Header struct {
-	Mark string // string identyfikujący początek nagłówka
-	Name string // nazwa pliku
-	Size int64  // rozmiar pliku w bajtach
+	Mark  string      // string identyfikujący początek nagłówka
+	Name  string      // nazwa pliku
+	Size  int64       // rozmiar pliku w bajtach
+	Type  string      // rodzaj pliku: TypeFile, TypeDir, TypeSymlink lub TypeIndex
+	Mode  os.FileMode // prawa dostępu do pliku (bity os.ModePerm)
+	Mtime int64       // czas modyfikacji w sekundach od 1970-01-01 UTC
+	Uid   int         // identyfikator właściciela
+	Gid   int         // identyfikator grupy
+	Link  string      // cel dowiązania symbolicznego
+	Enc   string      // metoda kompresji zawartości; "" - bez kompresji
+	Usize int64       // rozmiar pliku przed kompresją (jeśli Enc != "")
+	Sum   string      // suma kontrolna zawartości: "alg:hex" (patrz NewHash)
 }
 
-// New tworzy i zwraca header z informacjami o pliku fname.
+// New tworzy i zwraca header z informacjami o pliku fname. Dowiązania
+// symboliczne nie są rozwijane. Rozmiar katalogów i dowiązań jest
+// równy 0 - w archiwum zapisywany jest tylko ich nagłówek.
 func New(fname string) (*Header, error) {
-	fi, err := os.Stat(fname)
+	fi, err := os.Lstat(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	err = CheckName(fname)
 	if err != nil {
 		return nil, err
 	}
 
 	h := &Header{
-		hdrmark,
-		fname,
-		fi.Size(),
+		Mark:  hdrmark,
+		Name:  fname,
+		Mode:  fi.Mode().Perm(),
+		Mtime: fi.ModTime().Unix(),
+	}
+	h.Uid, h.Gid = owner(fi)
+
+	switch {
+	case fi.Mode().IsRegular():
+		h.Type = TypeFile
+		h.Size = fi.Size()
+	case fi.IsDir():
+		h.Type = TypeDir
+	case fi.Mode()&os.ModeSymlink != 0:
+		h.Type = TypeSymlink
+		h.Link, err = os.Readlink(fname)
+		if err != nil {
+			return nil, err
+		}
+		err = CheckName(h.Link)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("header: unsupported file type: %s: %s",
+			fname, fi.Mode().Type())
 	}
 	return h, nil
 }
 
+// CheckName sprawdza czy nazwa pliku name może być zapisana w
+// nagłówku tak, żeby przy czytaniu archiwum została odtworzona bez
+// zmian.
+func CheckName(name string) error {
+	if name == "" {
+		return errors.New("header: empty file name")
+	}
+	if strings.IndexByte(name, 0) >= 0 {
+		return fmt.Errorf("header: file name contains NUL: %q", name)
+	}
+	h, err := Parse((&Header{Mark: hdrmark, Name: name}).String())
+	if err != nil || h.Name != name {
+		return fmt.Errorf("header: can't encode file name: %q", name)
+	}
+	return nil
+}
+
+// needsQuote zwraca true jeśli nazwa pliku name musi być zapisana w
+// nagłówku w cudzysłowie: zawiera cudzysłów, odstępy, znaki
+// niedrukowalne lub bajty nie będące poprawnym kodem UTF-8. Pusta nazwa
+// nie jest poprawna (patrz CheckName).
+func needsQuote(name string) bool {
+	for _, r := range name {
+		if r == '"' || r == utf8.RuneError || unicode.IsSpace(r) ||
+			!unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteName zwraca nazwę pliku name w postaci zapisywanej w nagłówku.
+// Nazwy, które nie mogą być zapisane bezpośrednio, są zapisywane w
+// cudzysłowie z sekwencjami escape jak w języku Go (strconv.Quote).
+func quoteName(name string) string {
+	if needsQuote(name) {
+		return strconv.Quote(name)
+	}
+	return name
+}
+
+// fields dzieli s na pola oddzielone odstępami, jak strings.Fields.
+// String w cudzysłowie (patrz quoteName) na początku pola lub po znaku
+// '=' jest traktowany jako całość i zamieniany na postać bez
+// cudzysłowu. Cudzysłów, po którym nie występuje poprawny string w
+// cudzysłowie zakończony odstępem, jest zwykłym znakiem (jak w nazwach
+// plików ze starszych archiwów).
+func fields(s string) []string {
+	var a []string
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return a
+		}
+		var f []byte
+		for s != "" && !isSpace(s) {
+			if s[0] == '"' && (len(f) == 0 || f[len(f)-1] == '=') {
+				q, err := strconv.QuotedPrefix(s)
+				if err == nil && q[0] == '"' && isSpace(s[len(q):]) {
+					u, _ := strconv.Unquote(q)
+					f = append(f, u...)
+					s = s[len(q):]
+					break
+				}
+			}
+			f = append(f, s[0])
+			s = s[1:]
+		}
+		a = append(a, string(f))
+	}
+}
+
+// isSpace zwraca true jeśli s jest pusty lub zaczyna się od odstępu.
+func isSpace(s string) bool {
+	if s == "" {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsSpace(r)
+}
+
 // Parse parsuje header w postaci stringu s (jak w archiwum) i zwraca
-// obiekt Header.
+// obiekt Header. Nazwa pliku może być zapisana w cudzysłowie (patrz
+// String); nagłówki ze starszych archiwów, bez cudzysłowu i bez pól
+// key=value, są czytane jak dawniej. Nieznane pola key=value są
+// pomijane.
 func Parse(s string) (*Header, error) {
-	a := strings.Fields(s)
-	if len(a) != 3 {
+	a := fields(s)
+	if len(a) < 3 {
 		return nil, errors.New("header: wrong number of fields")
 	}
 
@@ -60,18 +199,106 @@ func Parse(s string) (*Header, error) {
 	}
 
 	h := &Header{
-		a[0],
-		a[1],
-		size,
+		Mark: a[0],
+		Name: a[1],
+		Size: size,
+	}
+	for _, f := range a[3:] {
+		err := h.parseField(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if (h.Type == TypeDir || h.Type == TypeSymlink) && h.Size != 0 {
+		return nil, fmt.Errorf("header: non-zero size of %s: %d", h.Type, h.Size)
 	}
 	return h, nil
 }
 
+// parseField parsuje opcjonalne pole nagłówka f postaci key=value i
+// ustawia odpowiednie pole h.
+func (h *Header) parseField(f string) error {
+	key, val, ok := strings.Cut(f, "=")
+	if !ok {
+		return fmt.Errorf("header: wrong field: %q", f)
+	}
+
+	var err error
+	switch key {
+	case "type":
+		switch val {
+		case TypeFile, TypeDir, TypeSymlink, TypeIndex:
+			h.Type = val
+		default:
+			err = errors.New("unknown file type")
+		}
+	case "mode":
+		var m uint64
+		m, err = strconv.ParseUint(val, 8, 32)
+		if m&^uint64(os.ModePerm) != 0 {
+			err = errors.New("not a permission mode")
+		}
+		h.Mode = os.FileMode(m)
+	case "mtime":
+		h.Mtime, err = strconv.ParseInt(val, 10, 64)
+	case "uid":
+		h.Uid, err = strconv.Atoi(val)
+	case "gid":
+		h.Gid, err = strconv.Atoi(val)
+	case "link":
+		h.Link = val
+	case "enc":
+		if val == "" {
+			err = errors.New("empty encoding")
+		}
+		h.Enc = val
+	case "usize":
+		h.Usize, err = strconv.ParseInt(val, 10, 64)
+		if err == nil && h.Usize < 0 {
+			err = errors.New("size <0")
+		}
+	case "sum":
+		err = checkSum(val)
+		h.Sum = val
+	}
+	if err != nil {
+		return fmt.Errorf("header: wrong field: %q: %v", f, err)
+	}
+	return nil
+}
+
 // String zwraca header w postaci takiej jak w archiwum - czyli string:
 // "-h- name size\n", gdzie name jest nazwą pliku a size jest rozmiarem pliku
-// w bajtach.
+// w bajtach. Nazwa zawierająca cudzysłów, odstępy, znaki niedrukowalne
+// albo niepoprawne kody UTF-8 jest zapisywana w cudzysłowie, np.:
+// -h- "my file.txt" 123.
+//
+// Jeśli pole Type nie jest puste, to po rozmiarze zapisywane są pola
+// z metadanymi pliku, np.:
+//
+//	-h- a.txt 123 type=file mode=0644 mtime=1412345678 uid=1000 gid=1000
+//	-h- lnk 0 type=symlink mode=0777 mtime=1412345678 uid=0 gid=0 link=a.txt
+//
+// Jeśli pole Enc nie jest puste, to zapisywana jest metoda kompresji i
+// rozmiar pliku przed kompresją, np. enc=rle usize=1234. Jeśli pole Sum
+// nie jest puste, to na końcu zapisywana jest suma kontrolna danych
+// pliku zapisanych w archiwum, np. sum=crc32:3610a686.
 func (h *Header) String() string {
-	return fmt.Sprintf("%s %s %d\n", h.Mark, h.Name, h.Size)
+	s := fmt.Sprintf("%s %s %d", h.Mark, quoteName(h.Name), h.Size)
+	if h.Type != "" {
+		s += fmt.Sprintf(" type=%s mode=%04o mtime=%d uid=%d gid=%d",
+			h.Type, uint32(h.Mode), h.Mtime, h.Uid, h.Gid)
+		if h.Link != "" {
+			s += " link=" + quoteName(h.Link)
+		}
+	}
+	if h.Enc != "" {
+		s += fmt.Sprintf(" enc=%s usize=%d", h.Enc, h.Usize)
+	}
+	if h.Sum != "" {
+		s += " sum=" + h.Sum
+	}
+	return s + "\n"
 }
 
 // Read czyta header z r.
@@ -3,6 +3,9 @@
 package header
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -13,10 +16,18 @@ func TestNew(t *testing.T) {
 		t.Error(err)
 	}
 	o := Header{ // oczekiwany header
-		"-h-",
-		"testfiles/a.txt",
-		15,
+		Mark: "-h-",
+		Name: "testfiles/a.txt",
+		Size: 15,
+		Type: TypeFile,
 	}
+	fi, err := os.Lstat("testfiles/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Mode = fi.Mode().Perm()
+	o.Mtime = fi.ModTime().Unix()
+	o.Uid, o.Gid = owner(fi)
 	if *h != o {
 		t.Errorf("oczekiwano: %v jest %v", o, *h)
 	}
@@ -28,6 +39,36 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewDirSymlink(t *testing.T) {
+	dir := t.TempDir()
+	d := filepath.Join(dir, "d")
+	err := os.Mkdir(d, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := filepath.Join(dir, "l")
+	err = os.Symlink("d", l)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	h, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Type != TypeDir || h.Size != 0 || h.Mode != 0750 {
+		t.Errorf("oczekiwano katalogu, jest: %v", *h)
+	}
+
+	h, err = New(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Type != TypeSymlink || h.Size != 0 || h.Link != "d" {
+		t.Errorf("oczekiwano dowiązania do d, jest: %v", *h)
+	}
+}
+
 func TestParse(t *testing.T) {
 	type test struct {
 		s string // string wejściowy
@@ -39,9 +80,9 @@ func TestParse(t *testing.T) {
 			"-h- abc.txt 123\n",
 			false,
 			Header{
-				"-h-",
-				"abc.txt",
-				123,
+				Mark: "-h-",
+				Name: "abc.txt",
+				Size: 123,
 			},
 		},
 		{
@@ -50,9 +91,9 @@ func TestParse(t *testing.T) {
 			"  -h-   a.txt\t123 \n",
 			false,
 			Header{
-				"-h-",
-				"a.txt",
-				123,
+				Mark: "-h-",
+				Name: "a.txt",
+				Size: 123,
 			},
 		},
 		{
@@ -60,9 +101,9 @@ func TestParse(t *testing.T) {
 			"-h- a.txt 0\n",
 			false,
 			Header{
-				"-h-",
-				"a.txt",
-				0,
+				Mark: "-h-",
+				Name: "a.txt",
+				Size: 0,
 			},
 		},
 		{
@@ -83,6 +124,85 @@ func TestParse(t *testing.T) {
 			true,
 			Header{},
 		},
+		{
+			// metadane pliku
+			"-h- a.txt 12 type=file mode=0640 mtime=1412345678 uid=10 gid=20\n",
+			false,
+			Header{
+				Mark:  "-h-",
+				Name:  "a.txt",
+				Size:  12,
+				Type:  TypeFile,
+				Mode:  0640,
+				Mtime: 1412345678,
+				Uid:   10,
+				Gid:   20,
+			},
+		},
+		{
+			// dowiązanie symboliczne; nieznane pole jest pomijane
+			"-h- l 0 type=symlink link=\"a b\" new=x\n",
+			false,
+			Header{
+				Mark: "-h-",
+				Name: "l",
+				Type: TypeSymlink,
+				Link: "a b",
+			},
+		},
+		{
+			// indeks archiwum
+			"-h- .archive-index 50 type=index\n",
+			false,
+			Header{
+				Mark: "-h-",
+				Name: ".archive-index",
+				Size: 50,
+				Type: TypeIndex,
+			},
+		},
+		{
+			// plik skompresowany
+			"-h- a.txt 12 enc=rle usize=30\n",
+			false,
+			Header{
+				Mark:  "-h-",
+				Name:  "a.txt",
+				Size:  12,
+				Enc:   "rle",
+				Usize: 30,
+			},
+		},
+		{
+			// ujemny rozmiar przed kompresją
+			"-h- a.txt 12 enc=rle usize=-1\n",
+			true,
+			Header{},
+		},
+		{
+			// nieznany rodzaj pliku
+			"-h- a.txt 0 type=fifo\n",
+			true,
+			Header{},
+		},
+		{
+			// zły tryb dostępu
+			"-h- a.txt 0 type=file mode=0789\n",
+			true,
+			Header{},
+		},
+		{
+			// niezerowy rozmiar katalogu
+			"-h- d 5 type=dir\n",
+			true,
+			Header{},
+		},
+		{
+			// pole nie w postaci key=value
+			"-h- a.txt 0 type\n",
+			true,
+			Header{},
+		},
 	}
 
 	for i, tc := range tests {
@@ -115,12 +235,34 @@ func TestString(t *testing.T) {
 		},
 		{
 			Header{
-				"-h-",
-				"a.txt",
-				123,
+				Mark: "-h-",
+				Name: "a.txt",
+				Size: 123,
 			},
 			"-h- a.txt 123\n",
 		},
+		{
+			Header{
+				Mark:  "-h-",
+				Name:  "d",
+				Type:  TypeDir,
+				Mode:  0755,
+				Mtime: 1412345678,
+				Uid:   1000,
+				Gid:   100,
+			},
+			"-h- d 0 type=dir mode=0755 mtime=1412345678 uid=1000 gid=100\n",
+		},
+		{
+			Header{
+				Mark: "-h-",
+				Name: "l",
+				Type: TypeSymlink,
+				Mode: 0777,
+				Link: "my file",
+			},
+			"-h- l 0 type=symlink mode=0777 mtime=0 uid=0 gid=0 link=\"my file\"\n",
+		},
 	}
 
 	for i, tc := range tests {
@@ -130,3 +272,133 @@ func TestString(t *testing.T) {
 		}
 	}
 }
+
+func TestQuotedName(t *testing.T) {
+	type test struct {
+		name string // nazwa pliku
+		s    string // oczekiwany nagłówek
+	}
+	tests := []test{
+		{"a.txt", "-h- a.txt 1\n"},
+		{"my file.txt", "-h- \"my file.txt\" 1\n"},
+		{"a\tb", "-h- \"a\\tb\" 1\n"},
+		{"a\nb", "-h- \"a\\nb\" 1\n"},
+		{"\"a\"", "-h- \"\\\"a\\\"\" 1\n"},
+		{"a\"b", "-h- \"a\\\"b\" 1\n"},
+		{"zażółć.txt", "-h- zażółć.txt 1\n"},
+		{"a\xffb", "-h- \"a\\xffb\" 1\n"},
+	}
+
+	for i, tc := range tests {
+		h := Header{
+			Mark: "-h-",
+			Name: tc.name,
+			Size: 1,
+		}
+		s := h.String()
+		if s != tc.s {
+			t.Errorf("tc %d: oczekiwano: %q jest: %q", i, tc.s, s)
+		}
+		p, err := Parse(s)
+		if err != nil {
+			t.Errorf("tc %d: %s", i, err)
+			continue
+		}
+		if *p != h {
+			t.Errorf("tc %d: oczekiwano: %v jest: %v", i, h, *p)
+		}
+	}
+}
+
+func TestParseQuoted(t *testing.T) {
+	type test struct {
+		s string // string wejściowy
+		e bool   // czy powinien wystąpić błąd
+		n string // oczekiwana nazwa pliku
+	}
+	tests := []test{
+		{"-h- \"a b\" 12\n", false, "a b"},
+		{"-h-  \"a b\"\t12 \n", false, "a b"},
+		// nazwy ze starszych archiwów, zaczynające się od cudzysłowu
+		{"-h- \"ab 12\n", false, "\"ab"},
+		{"-h- \"a\"b 12\n", false, "\"a\"b"},
+		{"-h- \"a b\"\n", true, ""},
+		{"-h- \"a b\" 12 13\n", true, ""},
+		{"-h- \"a b 12\n", true, ""},
+	}
+
+	for i, tc := range tests {
+		h, err := Parse(tc.s)
+		if tc.e {
+			if err == nil {
+				t.Errorf("tc %d: powinien wystąpić błąd", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tc %d: %s", i, err)
+			continue
+		}
+		if h.Name != tc.n {
+			t.Errorf("tc %d: oczekiwano: %q jest: %q", i, tc.n, h.Name)
+		}
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	names := []string{"", "a\x00b"}
+	for i, name := range names {
+		if CheckName(name) == nil {
+			t.Errorf("tc %d: powinien wystąpić błąd dla nazwy %q", i, name)
+		}
+	}
+	if err := CheckName("my file.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	type test struct {
+		alg string // algorytm
+		in  string // dane
+		sum string // oczekiwana suma
+	}
+	tests := []test{
+		{SumCRC32, "", "crc32:00000000"},
+		{SumCRC32, "aaa\n", "crc32:77f85d95"},
+		{SumSHA256, "", "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+
+	for i, tc := range tests {
+		sum, err := Checksum(tc.alg, strings.NewReader(tc.in))
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+		if sum != tc.sum {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, tc.sum, sum)
+		}
+		h, err := Parse("-h- a 0 sum=" + sum + "\n")
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+		if h.Sum != sum || h.SumAlg() != tc.alg {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, sum, h.Sum)
+		}
+	}
+
+	bad := []string{
+		"-h- a 0 sum=00000000\n",
+		"-h- a 0 sum=md5:00000000\n",
+		"-h- a 0 sum=crc32:0000000\n",
+		"-h- a 0 sum=crc32:0000000g\n",
+		"-h- a 0 sum=crc32:ABCDEF00\n",
+	}
+	for i, s := range bad {
+		_, err := Parse(s)
+		if err == nil {
+			t.Errorf("#%d: %q: powinien wystąpić błąd", i, s)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package header
+
+import (
+	"os"
+)
+
+// owner zwraca identyfikatory właściciela i grupy pliku fi. W systemach
+// innych niż Unix zwraca zera.
+func owner(fi os.FileInfo) (uid, gid int) {
+	return 0, 0
+}
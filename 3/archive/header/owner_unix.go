@@ -0,0 +1,17 @@
+//go:build unix
+
+package header
+
+import (
+	"os"
+	"syscall"
+)
+
+// owner zwraca identyfikatory właściciela i grupy pliku fi.
+func owner(fi os.FileInfo) (uid, gid int) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return int(st.Uid), int(st.Gid)
+}
@@ -0,0 +1,79 @@
+package header
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// Algorytmy sum kontrolnych zawartości plików.
+const (
+	SumCRC32  = "crc32"  // CRC-32 (IEEE), 8 cyfr szesnastkowych
+	SumSHA256 = "sha256" // SHA-256, 64 cyfry szesnastkowe
+)
+
+// NewHash zwraca obiekt obliczający sumę kontrolną algorytmem alg.
+func NewHash(alg string) (hash.Hash, error) {
+	switch alg {
+	case SumCRC32:
+		return crc32.NewIEEE(), nil
+	case SumSHA256:
+		return sha256.New(), nil
+	}
+	return nil, fmt.Errorf("header: unknown checksum algorithm: %q", alg)
+}
+
+// FormatSum zwraca sumę kontrolną obliczoną przez hh algorytmem alg w
+// postaci zapisywanej w polu Sum nagłówka: "alg:hex".
+func FormatSum(alg string, hh hash.Hash) string {
+	return alg + ":" + hex.EncodeToString(hh.Sum(nil))
+}
+
+// Checksum oblicza sumę kontrolną danych czytanych z r algorytmem alg
+// i zwraca ją w postaci zapisywanej w polu Sum nagłówka.
+func Checksum(alg string, r io.Reader) (string, error) {
+	hh, err := NewHash(alg)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(hh, r)
+	if err != nil {
+		return "", err
+	}
+	return FormatSum(alg, hh), nil
+}
+
+// SumAlg zwraca nazwę algorytmu sumy kontrolnej z pola Sum nagłówka,
+// lub pusty string jeśli nagłówek nie zawiera sumy kontrolnej.
+func (h *Header) SumAlg() string {
+	alg, _, _ := strings.Cut(h.Sum, ":")
+	return alg
+}
+
+// checkSum sprawdza poprawność sumy kontrolnej s postaci "alg:hex".
+func checkSum(s string) error {
+	alg, x, ok := strings.Cut(s, ":")
+	if !ok {
+		return errors.New("missing algorithm")
+	}
+	hh, err := NewHash(alg)
+	if err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(x)
+	if err != nil {
+		return err
+	}
+	if len(b) != hh.Size() {
+		return errors.New("wrong checksum length")
+	}
+	if x != strings.ToLower(x) {
+		return errors.New("checksum not in lower case")
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Czas oczekiwania na zwolnienie blokady przez inny proces.
+const lockwait = 30 * time.Second
+
+// lock zakłada blokadę archiwum aname tworząc plik blokady (patrz
+// lockname), czekając jeśli plik już istnieje. Zwraca plik blokady,
+// który należy przekazać do unlock. W systemach innych niż Unix plik
+// blokady pozostaje po przerwaniu programu i trzeba go usunąć ręcznie.
+func lock(aname string) (*os.File, error) {
+	name := lockname(aname)
+	deadline := time.Now().Add(lockwait)
+	for {
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsExist(err) || time.Now().After(deadline) {
+			return nil, fmt.Errorf("blokada %s: %v", name, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// unlock zwalnia blokadę założoną przez lock, usuwając plik blokady.
+func unlock(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
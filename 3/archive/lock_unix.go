@@ -0,0 +1,50 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lock zakłada blokadę (advisory lock, flock) na pliku blokady archiwum
+// aname (patrz lockname), czekając jeśli blokadę ma inny proces
+// archive. Zwraca plik blokady, który należy przekazać do unlock.
+// Blokada jest zwalniana przez system także po zakończeniu procesu,
+// więc plik blokady nie jest usuwany.
+func lock(aname string) (*os.File, error) {
+	f, err := os.OpenFile(lockname(aname), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	fd := int(f.Fd())
+	err = flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		fmt.Fprintf(os.Stderr, "archive: czekam na blokadę %s\n", f.Name())
+		err = flock(fd, syscall.LOCK_EX)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("blokada %s: %v", f.Name(), err)
+	}
+	return f, nil
+}
+
+// flock wywołuje syscall.Flock, powtarzając wywołanie przerwane przez
+// sygnał.
+func flock(fd, how int) error {
+	for {
+		err := syscall.Flock(fd, how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// unlock zwalnia blokadę założoną przez lock.
+func unlock(f *os.File) {
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	f.Close()
+}
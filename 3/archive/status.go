@@ -0,0 +1,167 @@
+// Plik zawiera funkcjonalność związaną z porównywaniem plików archiwum
+// z plikami na dysku (parametr -s).
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/adbr/npwp/3/archive/arch"
+	"github.com/adbr/npwp/3/archive/header"
+)
+
+// status porównuje pliki archiwum aname z plikami o tych samych
+// nazwach na dysku i drukuje do w pliki różniące się: ZMIENIONY
+// (z przyczyną różnicy), BRAK NA DYSKU lub NOWY (plik na dysku, którego
+// nie ma w archiwum). Pliki nowe są szukane tylko wśród podanych
+// nazw plików i w zawartości podanych katalogów - czyli tam, gdzie
+// dodałby je parametr -u. Zwraca błąd jeśli są jakieś różnice.
+func status(aname string, w io.Writer) error {
+	f, err := os.Open(aname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr := arch.NewReader(f)
+
+	members := make(map[string]bool) // nazwy wszystkich plików archiwum
+	ndiff := 0                       // liczba różniących się plików
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		members[hdr.Name] = true
+
+		if !filearg(hdr.Name) {
+			continue
+		}
+		st, err := diff(hdr, tr)
+		if err != nil {
+			return sumerr(hdr.Name, err)
+		}
+		if st != "" {
+			fmt.Fprintf(w, "%s: %s\n", hdr.Name, st)
+			ndiff++
+		}
+	}
+
+	for i, fname := range fnames {
+		err := filepath.WalkDir(fname, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == fname && !fstats[i] && errors.Is(err, fs.ErrNotExist) {
+					fmt.Fprintf(os.Stderr, "%s: nie ma w archiwum ani na dysku\n", fname)
+					return nil
+				}
+				return err
+			}
+			if !members[path] {
+				fmt.Fprintf(w, "%s: NOWY\n", path)
+				ndiff++
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if ndiff > 0 {
+		return fmt.Errorf("różniące się pliki: %d", ndiff)
+	}
+	return nil
+}
+
+// diff porównuje plik archiwum o nagłówku hdr i zawartości czytanej z
+// r z plikiem o tej samej nazwie na dysku. Zwraca opis różnicy lub ""
+// jeśli pliki się nie różnią. Porównywany jest rodzaj pliku, prawa
+// dostępu (jeśli są w nagłówku), cel dowiązania i zawartość pliku.
+// Zawartość jest porównywana za pomocą sumy kontrolnej z nagłówka, a
+// jeśli jej nie ma (lub plik jest skompresowany) - bajt po bajcie.
+// Czas modyfikacji nie jest porównywany.
+func diff(hdr *header.Header, r io.Reader) (string, error) {
+	h, err := header.New(hdr.Name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "BRAK NA DYSKU", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	typ := hdr.Type
+	if typ == "" {
+		// nagłówek bez metadanych (starsze archiwum)
+		typ = header.TypeFile
+	}
+	switch {
+	case h.Type != typ:
+		return "ZMIENIONY: rodzaj pliku", nil
+	case hdr.Type != "" && h.Mode != hdr.Mode:
+		return "ZMIENIONY: prawa dostępu", nil
+	case typ == header.TypeSymlink && h.Link != hdr.Link:
+		return "ZMIENIONY: cel dowiązania", nil
+	case typ == header.TypeFile && h.Size != datasize(hdr):
+		return "ZMIENIONY: rozmiar", nil
+	case typ != header.TypeFile:
+		return "", nil
+	}
+
+	f, err := os.Open(hdr.Name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var same bool
+	if hdr.Sum != "" && hdr.Enc == "" {
+		var sum string
+		sum, err = header.Checksum(hdr.SumAlg(), f)
+		same = sum == hdr.Sum
+	} else {
+		var rc io.ReadCloser
+		rc, err = decoder(hdr, r)
+		if err != nil {
+			return "", err
+		}
+		same, err = equal(f, rc)
+		rc.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+	if !same {
+		return "ZMIENIONY: zawartość", nil
+	}
+	return "", nil
+}
+
+// equal sprawdza czy r1 i r2 zawierają te same dane.
+func equal(r1, r2 io.Reader) (bool, error) {
+	b1 := make([]byte, 32*1024)
+	b2 := make([]byte, 32*1024)
+	for {
+		n1, err1 := io.ReadFull(r1, b1)
+		n2, err2 := io.ReadFull(r2, b2)
+		for _, err := range []error{err1, err2} {
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return false, err
+			}
+		}
+		if !bytes.Equal(b1[:n1], b2[:n2]) {
+			return false, nil
+		}
+		if err1 != nil || err2 != nil {
+			// oba są na końcu, bo przeczytano tyle samo bajtów
+			return true, nil
+		}
+	}
+}
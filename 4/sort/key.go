@@ -0,0 +1,427 @@
+// Plik zawiera funkcjonalność związaną z kluczami sortowania (opcje -k
+// i -t) i modyfikatorami kolejności (opcje -b, -f, -h, -M, -n, -r).
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/collate"
+)
+
+// Typ mods zawiera modyfikatory sposobu porównywania kluczy. Nazwy
+// modyfikatorów w specyfikacji klucza są podane w komentarzach.
+type mods struct {
+	blanks  bool // b: pomijanie odstępów na początku klucza
+	fold    bool // f: utożsamianie małych i wielkich liter
+	human   bool // h: liczby z przyrostkiem wielkości, np. 2K, 1G
+	month   bool // M: skróty nazw miesięcy, np. sty, Jan
+	numeric bool // n: liczby, np. -12.5
+	reverse bool // r: odwrotna kolejność
+}
+
+// Typ key opisuje klucz sortowania: fragment wiersza od znaku schar
+// pola sfield do znaku echar pola efield (włącznie) oraz sposób jego
+// porównywania. Pola i znaki w polach są numerowane od 1.
+type key struct {
+	sfield int // pole początku klucza
+	schar  int // znak początku klucza w polu sfield; 0 - początek pola
+	efield int // pole końca klucza; 0 - koniec wiersza
+	echar  int // znak końca klucza w polu efield; 0 - koniec pola
+	mods
+}
+
+// Typ keyList jest listą kluczy sortowania podawanych w wielokrotnie
+// powtarzanej opcji -k. Implementuje interfejs flag.Value.
+type keyList []key
+
+func (l *keyList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *keyList) Set(s string) error {
+	k, err := parsekey(s)
+	if err != nil {
+		return fmt.Errorf("zły klucz %q: %s", s, err)
+	}
+	*l = append(*l, k)
+	return nil
+}
+
+var (
+	keys    keyList // klucze sortowania (-k); pusta - cały wiersz
+	sep     rune    // separator pól (-t); 0 - pola oddzielone odstępami
+	defmods mods    // modyfikatory dla wiersza i kluczy bez modyfikatorów
+)
+
+// parsekey parsuje specyfikację klucza s postaci
+// pole[.znak][mod][,pole[.znak][mod]], gdzie mod jest ciągiem liter
+// modyfikatorów (patrz mods), np. 3,3n lub 2.3b,2.5.
+func parsekey(s string) (key, error) {
+	var k key
+	start, end, hasend := strings.Cut(s, ",")
+
+	var err error
+	var opts string
+	k.sfield, k.schar, opts, err = parsepos(start)
+	if err != nil {
+		return k, err
+	}
+	if k.sfield < 1 {
+		return k, errors.New("numer pola musi być większy od 0")
+	}
+	if k.schar < 0 || strings.Contains(start, ".") && k.schar == 0 {
+		return k, errors.New("numer znaku musi być większy od 0")
+	}
+	err = parsemods(opts, &k.mods)
+	if err != nil {
+		return k, err
+	}
+
+	if hasend {
+		k.efield, k.echar, opts, err = parsepos(end)
+		if err != nil {
+			return k, err
+		}
+		if k.efield < 1 {
+			return k, errors.New("numer pola musi być większy od 0")
+		}
+		if k.echar < 0 {
+			return k, errors.New("ujemny numer znaku")
+		}
+		err = parsemods(opts, &k.mods)
+		if err != nil {
+			return k, err
+		}
+	}
+	return k, k.mods.check()
+}
+
+// parsepos parsuje pozycję początku lub końca klucza s postaci
+// pole[.znak][mod] i zwraca numer pola, numer znaku (0 jeśli nie
+// podano) i ciąg liter modyfikatorów.
+func parsepos(s string) (field, char int, opts string, err error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	f, c, hasdot := strings.Cut(s[:i], ".")
+	field, err = strconv.Atoi(f)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("zły numer pola: %q", f)
+	}
+	if hasdot {
+		char, err = strconv.Atoi(c)
+		if err != nil {
+			return 0, 0, "", fmt.Errorf("zły numer znaku: %q", c)
+		}
+	}
+	return field, char, s[i:], nil
+}
+
+// parsemods ustawia w m modyfikatory podane literami w opts.
+func parsemods(opts string, m *mods) error {
+	for _, r := range opts {
+		switch r {
+		case 'b':
+			m.blanks = true
+		case 'f':
+			m.fold = true
+		case 'h':
+			m.human = true
+		case 'M':
+			m.month = true
+		case 'n':
+			m.numeric = true
+		case 'r':
+			m.reverse = true
+		default:
+			return fmt.Errorf("nieznany modyfikator: %q", r)
+		}
+	}
+	return nil
+}
+
+// check sprawdza czy modyfikatory m się nie wykluczają: tylko jeden z
+// modyfikatorów h, M i n może być podany.
+func (m mods) check() error {
+	n := 0
+	for _, b := range []bool{m.human, m.month, m.numeric} {
+		if b {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("modyfikatory h, M i n wykluczają się")
+	}
+	return nil
+}
+
+// compare porównuje wiersze a i b według kluczy sortowania keys i
+// zwraca liczbę ujemną, 0 lub dodatnią, gdy a jest odpowiednio
+// mniejszy, równy lub większy od b. Wiersze o równych kluczach są
+// porównywane w całości (z uwzględnieniem opcji -r). Bez kluczy
+// kluczem jest cały wiersz, porównywany z modyfikatorami defmods.
+// Napisy są porównywane zgodnie z kolejnością (collate) c.
+func compare(a, b string, c *collate.Collator) int {
+	if len(keys) == 0 {
+		k := key{sfield: 1, mods: defmods}
+		r := cmpkey(keystr(a, &k), keystr(b, &k), &k.mods, c)
+		if r != 0 {
+			return r
+		}
+	}
+	for i := range keys {
+		k := &keys[i]
+		r := cmpkey(keystr(a, k), keystr(b, k), &k.mods, c)
+		if r != 0 {
+			return r
+		}
+	}
+
+	r := c.CompareString(a, b)
+	if defmods.reverse {
+		r = -r
+	}
+	return r
+}
+
+// cmpkey porównuje klucze x i y sposobem określonym przez m.
+func cmpkey(x, y string, m *mods, c *collate.Collator) int {
+	var r int
+	switch {
+	case m.numeric:
+		r = cmpnum(x, y)
+	case m.human:
+		r = cmphuman(x, y)
+	case m.month:
+		r = month(x) - month(y)
+	case m.fold:
+		r = c.CompareString(strings.ToLower(x), strings.ToLower(y))
+	default:
+		r = c.CompareString(x, y)
+	}
+	if m.reverse {
+		r = -r
+	}
+	return r
+}
+
+// keystr zwraca klucz k wiersza line. Znak \n na końcu wiersza nie
+// należy do klucza. Jeśli początek klucza jest za jego końcem, to
+// klucz jest pusty.
+func keystr(line string, k *key) string {
+	line = strings.TrimSuffix(line, "\n")
+
+	beg := fieldstart(line, k.sfield)
+	if k.blanks {
+		beg = skipblanks(line, beg)
+	}
+	if k.schar > 1 {
+		beg = skipchars(line, beg, k.schar-1)
+	}
+
+	end := len(line)
+	switch {
+	case k.efield == 0:
+	case k.echar == 0:
+		end = skipfield(line, fieldstart(line, k.efield))
+	default:
+		end = fieldstart(line, k.efield)
+		if k.blanks {
+			end = skipblanks(line, end)
+		}
+		end = skipchars(line, end, k.echar)
+	}
+
+	if end <= beg {
+		return ""
+	}
+	return line[beg:end]
+}
+
+// fieldstart zwraca indeks początku pola n (od 1) wiersza line lub
+// len(line), jeśli wiersz ma mniej pól. Bez separatora sep pole
+// zaczyna się od odstępów poprzedzających jego tekst.
+func fieldstart(line string, n int) int {
+	i := 0
+	for f := 1; f < n; f++ {
+		i = skipfield(line, i)
+		if i == len(line) {
+			return i
+		}
+		if sep != 0 {
+			i += utf8.RuneLen(sep)
+		}
+	}
+	return i
+}
+
+// skipfield zwraca indeks końca pola zaczynającego się od indeksu i:
+// indeks następnego separatora sep, a bez separatora - indeks
+// pierwszego odstępu po tekście pola.
+func skipfield(line string, i int) int {
+	if sep != 0 {
+		j := strings.IndexRune(line[i:], sep)
+		if j < 0 {
+			return len(line)
+		}
+		return i + j
+	}
+	i = skipblanks(line, i)
+	for i < len(line) && !isblank(line[i]) {
+		i++
+	}
+	return i
+}
+
+// skipblanks zwraca indeks pierwszego znaku nie będącego odstępem od
+// indeksu i.
+func skipblanks(line string, i int) int {
+	for i < len(line) && isblank(line[i]) {
+		i++
+	}
+	return i
+}
+
+// skipchars zwraca indeks znaku o n znaków (nie bajtów) dalej od
+// indeksu i, ale nie dalej niż koniec wiersza.
+func skipchars(line string, i, n int) int {
+	for ; n > 0 && i < len(line); n-- {
+		_, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+	}
+	return i
+}
+
+// isblank sprawdza czy c jest odstępem (spacją lub tabulacją).
+func isblank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// Typ number zawiera liczbę dziesiętną w postaci tekstowej, bez
+// zbędnych zer - tak, żeby można było porównywać liczby dowolnej
+// długości.
+type number struct {
+	neg   bool   // czy liczba jest ujemna
+	ipart string // część całkowita bez zer na początku
+	fpart string // część ułamkowa bez zer na końcu
+}
+
+// parsenum parsuje liczbę na początku s (po odstępach) i zwraca ją
+// razem z resztą s. Napis nie zaczynający się od liczby jest
+// traktowany jak 0.
+func parsenum(s string) (number, string) {
+	var n number
+	s = strings.TrimLeft(s, " \t")
+	if strings.HasPrefix(s, "-") {
+		n.neg = true
+		s = s[1:]
+	}
+	i := 0
+	for i < len(s) && isdigit(s[i]) {
+		i++
+	}
+	n.ipart = strings.TrimLeft(s[:i], "0")
+	s = s[i:]
+	if strings.HasPrefix(s, ".") {
+		i = 1
+		for i < len(s) && isdigit(s[i]) {
+			i++
+		}
+		n.fpart = strings.TrimRight(s[1:i], "0")
+		s = s[i:]
+	}
+	if n.ipart == "" && n.fpart == "" {
+		n.neg = false // -0 == 0
+	}
+	return n, s
+}
+
+// isdigit sprawdza czy c jest cyfrą dziesiętną.
+func isdigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// cmpnumber porównuje liczby x i y.
+func cmpnumber(x, y number) int {
+	if x.neg != y.neg {
+		if x.neg {
+			return -1
+		}
+		return 1
+	}
+	r := len(x.ipart) - len(y.ipart)
+	if r == 0 {
+		r = strings.Compare(x.ipart, y.ipart)
+	}
+	if r == 0 {
+		r = strings.Compare(x.fpart, y.fpart)
+	}
+	if x.neg {
+		r = -r
+	}
+	return r
+}
+
+// cmpnum porównuje liczby na początku napisów x i y (modyfikator n).
+func cmpnum(x, y string) int {
+	nx, _ := parsenum(x)
+	ny, _ := parsenum(y)
+	return cmpnumber(nx, ny)
+}
+
+// Przyrostki wielkości liczb w kolejności rosnącej (modyfikator h).
+const units = "KMGTPE"
+
+// cmphuman porównuje liczby z przyrostkami wielkości na początku
+// napisów x i y (modyfikator h), np. 900K < 1.5M < 2G. Najpierw
+// porównywane są znaki liczb, następnie przyrostki, a na końcu
+// wartości liczb.
+func cmphuman(x, y string) int {
+	nx, sx := parsenum(x)
+	ny, sy := parsenum(y)
+	if nx.neg != ny.neg {
+		return cmpnumber(nx, ny)
+	}
+	r := unit(sx) - unit(sy)
+	if nx.neg {
+		r = -r
+	}
+	if r == 0 {
+		r = cmpnumber(nx, ny)
+	}
+	return r
+}
+
+// unit zwraca numer przyrostka wielkości na początku s (1 dla K, 2 dla
+// M itd.) lub 0 jeśli s nie zaczyna się od przyrostka.
+func unit(s string) int {
+	if s == "" {
+		return 0
+	}
+	return strings.IndexByte(units, s[0]&^0x20) + 1 // &^0x20: wielka litera
+}
+
+// months zawiera numery miesięcy według pierwszych trzech liter ich
+// nazw, polskich i angielskich.
+var months = map[string]int{
+	"sty": 1, "lut": 2, "mar": 3, "kwi": 4, "maj": 5, "cze": 6,
+	"lip": 7, "sie": 8, "wrz": 9, "paź": 10, "lis": 11, "gru": 12,
+	"jan": 1, "feb": 2, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+// month zwraca numer miesięca (1-12), którego nazwa jest na początku s
+// (po odstępach), lub 0 jeśli s nie zaczyna się od nazwy miesiąca.
+func month(s string) int {
+	s = strings.TrimLeft(s, " \t")
+	s = s[:skipchars(s, 0, 3)]
+	return months[strings.ToLower(s)]
+}
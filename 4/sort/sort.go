@@ -12,9 +12,12 @@
 // - Algorytm quicksort jest nie optymalny - np bardzo długo sortuje
 //   plik /usr/share/dict/words - może z tego powodu, że plik jest już
 //   posortowany, a to jest najgorszy przypadek dla tego algorytmu.
+//   Poprawka: pivot jest wybierany losowo, a elementy równe pivotowi
+//   są wydzielane podczas podziału.
 // - Wybieranie najmniejszego wiersza podczas łączenia plików tymczasowych
-//   jest robione przez przeszukiwanie liniowe, zamiast przy użyciu stogu
-//   jak w książce.
+//   jest robione przy użyciu stogu (container/heap), jak w książce.
+//   Wcześniej było robione przez przeszukiwanie liniowe - porównanie w
+//   BenchmarkMerge (sort_test.go).
 
 // Narzędzia Programistyczne w Pascalu,
 // rozdział 4.5 "Sortowanie dużych plików",
@@ -26,7 +29,7 @@
 //
 // SPOSÓB UŻYCIA
 //
-// sort [<file1] [>file2]
+// sort [-bfhMnr] [-t sep] [-k key ...] [-m n] [-S size] [-R] [<file1] [>file2]
 //
 // OPIS
 //
@@ -36,12 +39,57 @@
 // zapisywane w plikach tymczasowych, które następnie są łączone. Pliki
 // tymczasowe mają nazwy stemp# gdzie # jest liczbą całkowitą.
 //
+// Wielkość fragmentów jest określona przez opcję -S size: pamięć
+// zajmowaną przez wiersze sortowane na raz, w bajtach lub z
+// przyrostkiem K, M lub G, np. -S 100M (domyślnie 32M). Opcja -R
+// powoduje tworzenie posortowanych serii wierszy metodą wyboru z
+// zastępowaniem (replacement selection), zamiast sortowania
+// fragmentów; serie są wtedy średnio dwa razy dłuższe niż pamięć -S,
+// więc plików tymczasowych jest mniej.
+//
+// Liczba plików tymczasowych łączonych na raz jest dobierana tak, żeby
+// wszystkie pliki zostały połączone w jednym przebiegu, jeśli jest ich
+// nie więcej niż 256 - a w przeciwnym razie w jak najmniejszej liczbie
+// przebiegów. Opcja -m n ustawia tę liczbę na n (co najmniej 2).
+//
+// Domyślnie wiersze są porównywane w całości, zgodnie z kolejnością
+// znaków języka polskiego (collate). Opcja -k key, która może wystąpić
+// wielokrotnie, określa klucz sortowania - fragment wiersza, według
+// którego wiersze są porównywane. Wiersze o równych pierwszych
+// kluczach są porównywane według kolejnych kluczy, a na końcu w
+// całości. Klucz ma postać:
+//
+//	pole[.znak][mod][,pole[.znak][mod]]
+//
+// gdzie pierwsza pozycja jest początkiem klucza, a druga (opcjonalna)
+// jego końcem; bez drugiej pozycji klucz sięga do końca wiersza. Pola
+// i znaki w polach są numerowane od 1; znak 0 lub brak znaku w
+// pozycji końca oznacza koniec pola. Pola są oddzielone separatorem
+// podanym w opcji -t, a bez tej opcji - ciągami odstępów (spacji i
+// tabulacji), które należą do następnego pola. Litery mod są
+// modyfikatorami sposobu porównywania klucza:
+//
+//	b  pomijanie odstępów na początku klucza
+//	f  utożsamianie małych i wielkich liter
+//	h  liczby z przyrostkami wielkości, np. 900K < 1.5M < 2G
+//	M  skróty nazw miesięcy, polskie lub angielskie, np. sty < lut
+//	n  liczby dziesiętne, np. -1.5 < 2 < 10
+//	r  odwrotna kolejność
+//
+// Opcje -b, -f, -h, -M, -n i -r ustawiają te same modyfikatory dla
+// całego wiersza i dla kluczy bez własnych modyfikatorów. Opcja -r
+// dotyczy też porównania całych wierszy o równych kluczach.
+//
 // PRZYKŁADY
 //
 // Sortowanie pliku file1 i zapisanie wyniku do pliku file2:
 //
 //	$sort <file1 >file2
 //
+// Sortowanie pliku CSV numerycznie według trzeciej kolumny, malejąco:
+//
+//	$sort -t , -k 3,3nr <raport.csv
+//
 // UWAGI
 //
 // Każdy wiersz w pliku powinien być zakończony znakiem \n - jeśli ostatni
@@ -53,27 +101,50 @@ package main
 
 import (
 	"bufio"
+	"container/heap"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/rand"
 	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"golang.org/x/text/collate"
 	"golang.org/x/text/language"
 )
 
 const (
-	tname      = "stemp" // prefix nazwy plików tymczasowych
-	maxlines   = 100     // liczba wierszy sortowanych na raz
-	mergeorder = 5       // liczba łaczonych plików
+	tname    = "stemp" // prefix nazwy plików tymczasowych
+	maxorder = 256     // maksymalna dobierana liczba łączonych plików
+	linesize = 16      // pamięć zajmowana przez wiersz poza jego treścią
 )
 
-// gtext czyta i zwraca maksymalnie maxlines wierszy z r. Gdy wystąpił
-// koniec pliku zwraca wczytane wiersze i io.EOF.
-func gtext(r *bufio.Reader, maxlines int) ([]string, error) {
+// Opcje sortowania zewnętrznego.
+var (
+	mergeorder       = 0        // liczba łączonych plików (-m); 0 - patrz morder
+	memsize    int64 = 32 << 20 // pamięć na wiersze sortowane na raz (-S)
+	replsel          = false    // czy tworzyć serie wyborem z zastępowaniem (-R)
+)
+
+const usageStr = "usage: sort [-bfhMnr] [-t sep] [-k key ...] [-m n] [-S size] [-R] [<file1] [>file2]"
+
+func usage() {
+	fmt.Fprintln(os.Stderr, usageStr)
+	os.Exit(1)
+}
+
+// gtext czyta i zwraca wiersze z r, dopóki zajmowana przez nie pamięć
+// (patrz lsize) jest mniejsza niż maxmem - czyta co najmniej jeden
+// wiersz. Gdy wystąpił koniec pliku zwraca wczytane wiersze i io.EOF.
+func gtext(r *bufio.Reader, maxmem int64) ([]string, error) {
 	var lines []string
+	var mem int64 // pamięć zajmowana przez lines
 	for {
-		if len(lines) >= maxlines {
+		if mem >= maxmem {
 			return lines, nil
 		}
 		line, err := r.ReadString('\n')
@@ -87,9 +158,16 @@ func gtext(r *bufio.Reader, maxlines int) ([]string, error) {
 			return lines, err
 		}
 		lines = append(lines, line)
+		mem += lsize(line)
 	}
 }
 
+// lsize zwraca szacowaną pamięć zajmowaną przez wiersz line: jego
+// treść i nagłówek stringu.
+func lsize(line string) int64 {
+	return int64(len(line)) + linesize
+}
+
 // ptext drukuje wiersze z lines do pliku w.
 func ptext(w io.Writer, lines []string) error {
 	for _, line := range lines {
@@ -106,40 +184,40 @@ func gname(n int) string {
 	return fmt.Sprintf("%s%d", tname, n)
 }
 
-// quicksort sortuje a metodą quicksort zgodnie z kolejnością (collate)
-// określoną przez c.
+// quicksort sortuje a metodą quicksort zgodnie z kluczami sortowania i
+// kolejnością (collate) określoną przez c (patrz compare). Pivot jest
+// wybierany losowo, a elementy równe pivotowi są wydzielane i nie są
+// dalej sortowane, więc dane już posortowane lub z wieloma powtórzeniami
+// nie są najgorszym przypadkiem. Rekurencja dotyczy mniejszej części,
+// więc jej głębokość nie przekracza log2(len(a)).
 func quicksort(a []string, c *collate.Collator) {
-	if len(a) < 2 {
-		return
-	}
-	xi := len(a) - 1 // indeks pivota
-	x := a[xi]       // wartość pivota
-	i, j := 0, len(a)-1
-	// zamieniaj miejscami elementy większe i mniejsze od pivota
-	for {
-		if i == j {
-			break
-		}
-		for {
-			if i == j || c.CompareString(a[i], x) > 0 {
-				break
+	for len(a) > 1 {
+		x := a[rand.Intn(len(a))] // wartość pivota
+		// podział na elementy mniejsze od pivota a[:lt], równe
+		// a[lt:gt] i większe a[gt:]
+		lt, i, gt := 0, 0, len(a)
+		for i < gt {
+			r := compare(a[i], x, c)
+			switch {
+			case r < 0:
+				a[lt], a[i] = a[i], a[lt]
+				lt++
+				i++
+			case r > 0:
+				gt--
+				a[i], a[gt] = a[gt], a[i]
+			default:
+				i++
 			}
-			i++
 		}
-		for {
-			if j == i || c.CompareString(a[j], x) < 0 {
-				break
-			}
-			j--
-		}
-		if i < j {
-			a[i], a[j] = a[j], a[i]
+		if lt < len(a)-gt {
+			quicksort(a[:lt], c)
+			a = a[gt:]
+		} else {
+			quicksort(a[gt:], c)
+			a = a[:lt]
 		}
 	}
-	// wstaw pivot w miejsce spotkania i j
-	a[i], a[xi] = a[xi], a[i]
-	quicksort(a[:i], c)
-	quicksort(a[i:], c)
 }
 
 func min(a, b int) int {
@@ -179,42 +257,60 @@ func gremove(files []*os.File) error {
 	return nil
 }
 
-// minLine zwraca indeks najmniejszego wiersza w lines lub -1 gdy lines
-// jest pusta lub zawiera same stringi puste. Stringi puste ("" - zero value)
-// są pomijane.
-func minLine(lines []string, c *collate.Collator) int {
-	min := -1
-	for i := range lines {
-		if lines[i] == "" {
-			continue
-		}
-		if min == -1 {
-			// pierwszy string != nil
-			min = i
-			continue
-		}
-		if c.CompareString(lines[i], lines[min]) < 0 {
-			min = i
-		}
-	}
-	return min
+// Typ run jest plikiem tymczasowym łączonym przez merge, razem z jego
+// bieżącym (najmniejszym nie zapisanym) wierszem.
+type run struct {
+	line string        // bieżący wiersz
+	r    *bufio.Reader // plik tymczasowy
+	n    int           // numer pliku w merge (kolejność równych wierszy)
 }
 
-// merge łączy posortowane pliki files i zapisuje posortowane wiersze
-// do pliku out.
-func merge(out *os.File, files []*os.File, c *collate.Collator) error {
-	nf := len(files)
+// Typ runHeap jest stogiem plików tymczasowych uporządkowanym według
+// ich bieżących wierszy (patrz compare). Implementuje interfejs
+// heap.Interface.
+type runHeap struct {
+	runs []run
+	c    *collate.Collator
+}
 
-	// utworzenie obiektów bufio.Reader dla plików - dla użycia ReadString
-	bfiles := make([]*bufio.Reader, nf)
-	for i, f := range files {
-		bfiles[i] = bufio.NewReader(f)
+func (h *runHeap) Len() int {
+	return len(h.runs)
+}
+
+func (h *runHeap) Less(i, j int) bool {
+	r := compare(h.runs[i].line, h.runs[j].line, h.c)
+	if r != 0 {
+		return r < 0
 	}
+	return h.runs[i].n < h.runs[j].n
+}
+
+func (h *runHeap) Swap(i, j int) {
+	h.runs[i], h.runs[j] = h.runs[j], h.runs[i]
+}
+
+func (h *runHeap) Push(x any) {
+	h.runs = append(h.runs, x.(run))
+}
+
+func (h *runHeap) Pop() any {
+	n := len(h.runs) - 1
+	x := h.runs[n]
+	h.runs = h.runs[:n]
+	return x
+}
+
+// merge łączy posortowane pliki files i zapisuje posortowane wiersze
+// do out. Najmniejszy z bieżących wierszy plików jest wybierany przy
+// użyciu stogu, więc koszt wybrania wiersza rośnie logarytmicznie z
+// liczbą plików.
+func merge(out io.Writer, files []*os.File, c *collate.Collator) error {
+	h := &runHeap{c: c}
 
 	// pobranie pierwszego wiersza z każdego pliku
-	lines := make([]string, nf)
-	for i, f := range bfiles {
-		line, err := f.ReadString('\n')
+	for i, f := range files {
+		r := bufio.NewReader(f)
+		line, err := r.ReadString('\n')
 		if err != nil && err != io.EOF {
 			return err
 		}
@@ -222,45 +318,78 @@ func merge(out *os.File, files []*os.File, c *collate.Collator) error {
 			return fmt.Errorf("merge: pusty plik tymczasowy: %s",
 				files[i].Name())
 		}
-		lines[i] = line
+		h.runs = append(h.runs, run{line, r, i})
 	}
+	heap.Init(h)
 
 	// łączenie
-	for nf > 0 {
-		i := minLine(lines, c)
-		if i < 0 {
-			panic("merge: ujemny indeks najmniejszego wiersza")
-		}
-
-		_, err := out.WriteString(lines[i])
+	for h.Len() > 0 {
+		top := &h.runs[0]
+		_, err := io.WriteString(out, top.line)
 		if err != nil {
 			return err
 		}
 
-		line, err := bfiles[i].ReadString('\n')
+		line, err := top.r.ReadString('\n')
 		if err != nil && err != io.EOF {
 			return err
 		}
 		if len(line) > 0 {
-			lines[i] = line
+			top.line = line
+			heap.Fix(h, 0)
 		} else {
-			lines[i] = ""
-			nf--
+			heap.Pop(h)
 		}
 	}
 	return nil
 }
 
-func main() {
-	// czytanie porcji wierszy, sortowanie i zapisywanie do plików tmp
-	c := collate.New(language.Polish)
-	r := bufio.NewReader(os.Stdin)
+// morder zwraca liczbę plików łączonych na raz, gdy jest nruns plików
+// tymczasowych: mergeorder, jeśli został ustawiony opcją -m, a w
+// przeciwnym razie najmniejszą liczbę (nie większą niż maxorder)
+// wystarczającą do połączenia wszystkich plików w najmniejszej
+// możliwej liczbie przebiegów - jeden przebieg dla nruns <= maxorder.
+func morder(nruns int) int {
+	if mergeorder > 0 {
+		return mergeorder
+	}
+	if nruns < 2 {
+		return 2
+	}
+
+	// liczba przebiegów
+	passes := 1
+	for n := maxorder; n < nruns; n *= maxorder {
+		passes++
+	}
+
+	// najmniejsze order takie, że order^passes >= nruns
+	order := 2
+	for pow(order, passes) < nruns {
+		order++
+	}
+	return order
+}
+
+// pow zwraca x do potęgi n.
+func pow(x, n int) int {
+	p := 1
+	for i := 0; i < n; i++ {
+		p *= x
+	}
+	return p
+}
+
+// sortruns czyta wiersze z r porcjami zajmującymi memsize bajtów
+// pamięci, sortuje każdą porcję metodą quicksort i zapisuje do
+// kolejnego pliku tymczasowego (serii). Zwraca liczbę serii.
+func sortruns(r *bufio.Reader, c *collate.Collator) (int, error) {
 	high := 0
 	done := false
 	for !done {
-		lines, err := gtext(r, maxlines)
+		lines, err := gtext(r, memsize)
 		if err != nil && err != io.EOF {
-			log.Fatal(err)
+			return high, err
 		}
 		if err == io.EOF {
 			if len(lines) == 0 {
@@ -275,18 +404,257 @@ func main() {
 		high++
 		file, err := os.Create(gname(high))
 		if err != nil {
-			log.Fatal(err)
+			return high, err
+		}
+		w := bufio.NewWriter(file)
+		err = ptext(w, lines)
+		if err == nil {
+			err = w.Flush()
 		}
-		err = ptext(file, lines)
 		if err != nil {
-			log.Fatal(err)
+			file.Close()
+			return high, err
+		}
+		err = file.Close()
+		if err != nil {
+			return high, err
+		}
+	}
+	return high, nil
+}
+
+// Typ sel jest wierszem w stogu selHeap, razem z numerem serii, do
+// której zostanie zapisany.
+type sel struct {
+	line string
+	run  int
+}
+
+// Typ selHeap jest stogiem wierszy uporządkowanym według numerów serii,
+// a w serii według wierszy (patrz compare). Implementuje interfejs
+// heap.Interface.
+type selHeap struct {
+	items []sel
+	c     *collate.Collator
+}
+
+func (h *selHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *selHeap) Less(i, j int) bool {
+	if h.items[i].run != h.items[j].run {
+		return h.items[i].run < h.items[j].run
+	}
+	return compare(h.items[i].line, h.items[j].line, h.c) < 0
+}
+
+func (h *selHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *selHeap) Push(x any) {
+	h.items = append(h.items, x.(sel))
+}
+
+func (h *selHeap) Pop() any {
+	n := len(h.items) - 1
+	x := h.items[n]
+	h.items = h.items[:n]
+	return x
+}
+
+// selruns tworzy serie wierszy z r metodą wyboru z zastępowaniem
+// (replacement selection): w stogu jest przechowywane memsize bajtów
+// wierszy; najmniejszy wiersz bieżącej serii jest zapisywany do pliku
+// tymczasowego i zastępowany następnym wierszem z r. Wiersz mniejszy
+// od ostatnio zapisanego należy do następnej serii. Dla danych w
+// losowej kolejności serie są średnio dwa razy dłuższe niż przy
+// sortruns, a dla danych prawie posortowanych - znacznie dłuższe.
+// Zwraca liczbę serii.
+func selruns(r *bufio.Reader, c *collate.Collator) (int, error) {
+	h := &selHeap{c: c}
+	var mem int64 // pamięć zajmowana przez wiersze w stogu
+	eof := false
+	high := 0 // numer bieżącej serii
+
+	// fill czyta wiersze do stogu, dopóki nie zajmują memsize bajtów;
+	// po zapisaniu pierwszego wiersza (high > 0) wiersze mniejsze niż
+	// ostatnio zapisany wiersz last należą do serii run+1
+	fill := func(last string, run int) error {
+		for !eof && mem < memsize {
+			line, err := r.ReadString('\n')
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+			if len(line) == 0 {
+				break
+			}
+			x := sel{line, run}
+			if high > 0 && compare(line, last, c) < 0 {
+				x.run++
+			}
+			heap.Push(h, x)
+			mem += lsize(line)
 		}
+		return nil
+	}
+
+	err := fill("", 1)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		file *os.File
+		w    *bufio.Writer
+	)
+	for h.Len() > 0 {
+		x := heap.Pop(h).(sel)
+		mem -= lsize(x.line)
+		if x.run != high {
+			// początek następnej serii
+			if file != nil {
+				err = closerun(file, w)
+				if err != nil {
+					return high, err
+				}
+			}
+			high = x.run
+			file, err = os.Create(gname(high))
+			if err != nil {
+				return high, err
+			}
+			w = bufio.NewWriter(file)
+		}
+		_, err = w.WriteString(x.line)
+		if err == nil {
+			err = fill(x.line, x.run)
+		}
+		if err != nil {
+			file.Close()
+			return high, err
+		}
+	}
+	if file != nil {
+		err = closerun(file, w)
+	}
+	return high, err
+}
+
+// closerun zapisuje bufor w i zamyka plik tymczasowy file.
+func closerun(file *os.File, w *bufio.Writer) error {
+	err := w.Flush()
+	if err != nil {
 		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// parsesize parsuje rozmiar pamięci s: liczbę bajtów z opcjonalnym
+// przyrostkiem K, M lub G (potęgi 1024), np. 512K, 100M.
+func parsesize(s string) (int64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("zły rozmiar pamięci: %q", s)
+	}
+	if s[i:] != "" {
+		u := unit(s[i:])
+		if u == 0 || u > 3 || len(s[i:]) != 1 || n > math.MaxInt64>>(10*u) {
+			return 0, fmt.Errorf("zły rozmiar pamięci: %q", s)
+		}
+		n <<= 10 * u
+	}
+	return n, nil
+}
+
+// getsep zwraca separator pól podany w opcji -t: jeden znak lub \t
+// (tabulacja).
+func getsep(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	if n == 0 || n != len(s) || r == utf8.RuneError || r == '\n' {
+		return 0, fmt.Errorf("zły separator pól: %q", s)
+	}
+	return r, nil
+}
+
+func main() {
+	log.SetPrefix("sort: ")
+	log.SetFlags(0)
+
+	flag.BoolVar(&defmods.blanks, "b", false, "pomija odstępy na początku kluczy")
+	flag.BoolVar(&defmods.fold, "f", false, "utożsamia małe i wielkie litery")
+	flag.BoolVar(&defmods.human, "h", false, "porównuje liczby z przyrostkami wielkości (2K, 1G)")
+	flag.BoolVar(&defmods.month, "M", false, "porównuje skróty nazw miesięcy")
+	flag.BoolVar(&defmods.numeric, "n", false, "porównuje liczby")
+	flag.BoolVar(&defmods.reverse, "r", false, "sortuje w odwrotnej kolejności")
+	flag.Var(&keys, "k", "klucz sortowania: pole[.znak][mod][,pole[.znak][mod]]")
+	t := flag.String("t", "", "separator pól")
+	flag.IntVar(&mergeorder, "m", 0, "liczba plików łączonych na raz; 0 - dobierana automatycznie")
+	size := flag.String("S", "32M", "pamięć na wiersze sortowane na raz, np. 512K, 100M")
+	flag.BoolVar(&replsel, "R", false, "tworzy serie metodą wyboru z zastępowaniem")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		usage()
+	}
+	if mergeorder == 1 || mergeorder < 0 {
+		log.Fatalf("zła liczba łączonych plików: %d", mergeorder)
+	}
+	err := defmods.check()
+	if err != nil {
+		log.Fatal(err)
+	}
+	memsize, err = parsesize(*size)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *t != "" {
+		sep, err = getsep(*t)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// klucze bez modyfikatorów dziedziczą modyfikatory globalne
+	for i := range keys {
+		if keys[i].mods == (mods{}) {
+			keys[i].mods = defmods
+		}
+	}
+
+	// tworzenie posortowanych serii wierszy w plikach tymczasowych
+	c := collate.New(language.Polish)
+	r := bufio.NewReader(os.Stdin)
+	var high int
+	if replsel {
+		high, err = selruns(r, c)
+	} else {
+		high, err = sortruns(r, c)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if high == 0 {
+		return // puste wejście
 	}
 
 	// łaczenie serii plików, aż zostanie tylko jeden plik
-	for low := 1; low <= high; low += mergeorder {
-		lim := min(low+mergeorder-1, high)
+	order := morder(high)
+	for low := 1; low < high; low += order {
+		lim := min(low+order-1, high)
 		files, err := gopen(low, lim)
 		if err != nil {
 			log.Fatal(err)
@@ -298,7 +666,12 @@ func main() {
 			log.Fatal(err)
 		}
 
-		err = merge(out, files, c)
+		w := bufio.NewWriter(out)
+		err = merge(w, files, c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = w.Flush()
 		if err != nil {
 			log.Fatal(err)
 		}
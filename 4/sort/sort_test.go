@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+func TestParsekey(t *testing.T) {
+	type test struct {
+		s   string // specyfikacja klucza
+		k   key    // oczekiwany klucz
+		err bool   // czy powinien wystąpić błąd
+	}
+	tests := []test{
+		{"1", key{sfield: 1}, false},
+		{"3,3", key{sfield: 3, efield: 3}, false},
+		{"2.3,2.5", key{sfield: 2, schar: 3, efield: 2, echar: 5}, false},
+		{"2,4.0", key{sfield: 2, efield: 4}, false},
+		{"3,3nr", key{sfield: 3, efield: 3, mods: mods{numeric: true, reverse: true}}, false},
+		{"1b,2f", key{sfield: 1, efield: 2, mods: mods{blanks: true, fold: true}}, false},
+		{"1M", key{sfield: 1, mods: mods{month: true}}, false},
+		{"1h", key{sfield: 1, mods: mods{human: true}}, false},
+		{"0", key{}, true},
+		{"1.0", key{}, true},
+		{"1,0", key{}, true},
+		{"", key{}, true},
+		{"a", key{}, true},
+		{"1x", key{}, true},
+		{"1.2.3", key{}, true},
+		{"1nh", key{}, true},
+	}
+
+	for i, tc := range tests {
+		k, err := parsekey(tc.s)
+		if tc.err {
+			if err == nil {
+				t.Errorf("#%d: %q: powinien wystąpić błąd", i, tc.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: %q: %s", i, tc.s, err)
+			continue
+		}
+		if k != tc.k {
+			t.Errorf("#%d: %q: oczekiwano: %+v, jest: %+v", i, tc.s, tc.k, k)
+		}
+	}
+}
+
+func TestKeystr(t *testing.T) {
+	defer func() { sep = 0 }()
+
+	type test struct {
+		sep  rune   // separator pól
+		key  string // specyfikacja klucza
+		line string // wiersz
+		out  string // oczekiwany klucz
+	}
+	tests := []test{
+		{0, "1", "ab cd\n", "ab cd"},
+		{0, "2", "ab cd ef\n", " cd ef"},
+		{0, "2b", "ab   cd ef\n", "cd ef"},
+		{0, "2,2", "ab cd ef\n", " cd"},
+		{0, "2b,2", "ab cd ef\n", "cd"},
+		{0, "1.2,1.3", "abcd ef\n", "bc"},
+		{0, "2.2b,2.3b", "ab   cdef\n", "de"},
+		{0, "4", "ab cd\n", ""},
+		{0, "1.2,1.1", "abc\n", ""},
+		{0, "1.2,1.3", "ąćęł\n", "ćę"},
+		{',', "2,2", "a,b,c\n", "b"},
+		{',', "2", "a,b,c\n", "b,c"},
+		{',', "3,3", "a,b,\n", ""},
+		{',', "2,2", "a,,c\n", ""},
+		{',', "2,2", " a, b ,c\n", " b "},
+		{';', "2,2", "a;ż;c\n", "ż"},
+	}
+
+	for i, tc := range tests {
+		sep = tc.sep
+		k, err := parsekey(tc.key)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		out := keystr(tc.line, &k)
+		if out != tc.out {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, tc.out, out)
+		}
+	}
+}
+
+func TestCmpnum(t *testing.T) {
+	type test struct {
+		x, y string
+		r    int // znak wyniku porównania
+	}
+	tests := []test{
+		{"1", "2", -1},
+		{"10", "9", 1},
+		{"  10", "10", 0},
+		{"010", "10", 0},
+		{"1.5", "1.50", 0},
+		{"1.5", "1.45", 1},
+		{"-1", "1", -1},
+		{"-10", "-9", -1},
+		{"-0", "0", 0},
+		{"abc", "0", 0},
+		{"", "-1", 1},
+		{"12345678901234567890", "12345678901234567891", -1},
+		{".5", "0.4", 1},
+		{"3 kg", "20 kg", -1},
+	}
+
+	for i, tc := range tests {
+		r := sign(cmpnum(tc.x, tc.y))
+		if r != tc.r {
+			t.Errorf("#%d: %q %q: oczekiwano: %d, jest: %d", i, tc.x, tc.y, tc.r, r)
+		}
+	}
+}
+
+func TestCmphuman(t *testing.T) {
+	type test struct {
+		x, y string
+		r    int // znak wyniku porównania
+	}
+	tests := []test{
+		{"900K", "1.5M", -1},
+		{"2G", "1.5M", 1},
+		{"10", "1K", -1},
+		{"1k", "1K", 0},
+		{"2K", "10K", -1},
+		{"-1G", "-1K", -1},
+		{"-1K", "1", -1},
+		{"1E", "1P", 1},
+	}
+
+	for i, tc := range tests {
+		r := sign(cmphuman(tc.x, tc.y))
+		if r != tc.r {
+			t.Errorf("#%d: %q %q: oczekiwano: %d, jest: %d", i, tc.x, tc.y, tc.r, r)
+		}
+	}
+}
+
+func TestMonth(t *testing.T) {
+	type test struct {
+		s string
+		m int // numer miesiąca
+	}
+	tests := []test{
+		{"sty", 1},
+		{"Styczeń", 1},
+		{"  lut 2014", 2},
+		{"PAŹ", 10},
+		{"października", 10},
+		{"Dec", 12},
+		{"march", 3},
+		{"xyz", 0},
+		{"", 0},
+		{"st", 0},
+	}
+
+	for i, tc := range tests {
+		m := month(tc.s)
+		if m != tc.m {
+			t.Errorf("#%d: %q: oczekiwano: %d, jest: %d", i, tc.s, tc.m, m)
+		}
+	}
+}
+
+// sign zwraca znak liczby n: -1, 0 lub 1.
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// mkruns tworzy w katalogu dir n plików tymczasowych zawierających po
+// nlines posortowanych, losowych wierszy i zwraca je otwarte do
+// czytania, razem z posortowanymi wierszami wszystkich plików.
+func mkruns(tb testing.TB, dir string, n, nlines int) ([]*os.File, []string) {
+	rnd := rand.New(rand.NewSource(1))
+	var all []string
+	files := make([]*os.File, n)
+	for i := range files {
+		lines := make([]string, nlines)
+		for j := range lines {
+			lines[j] = fmt.Sprintf("%08d\n", rnd.Intn(100000000))
+		}
+		sort.Strings(lines)
+		all = append(all, lines...)
+
+		name := filepath.Join(dir, fmt.Sprintf("run%d", i))
+		err := os.WriteFile(name, []byte(strings.Join(lines, "")), 0644)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		files[i], err = os.Open(name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		tb.Cleanup(func() { files[i].Close() })
+	}
+	sort.Strings(all)
+	return files, all
+}
+
+// rewind ustawia pliki files na początek.
+func rewind(tb testing.TB, files []*os.File) {
+	for _, f := range files {
+		_, err := f.Seek(0, io.SeekStart)
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	c := collate.New(language.Polish)
+	for _, n := range []int{1, 2, 5, 33} {
+		files, all := mkruns(t, t.TempDir(), n, 50)
+		var buf bytes.Buffer
+		err := merge(&buf, files, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := strings.Join(all, "")
+		if buf.String() != want {
+			t.Errorf("%d plików: złe wyniki łączenia", n)
+		}
+	}
+}
+
+func TestMorder(t *testing.T) {
+	type test struct {
+		nruns int // liczba plików tymczasowych
+		order int // oczekiwana liczba łączonych plików
+	}
+	tests := []test{
+		{0, 2},
+		{1, 2},
+		{2, 2},
+		{5, 5},
+		{256, 256},
+		{257, 17},  // 2 przebiegi: 17*17 >= 257
+		{1000, 32}, // 2 przebiegi: 32*32 >= 1000
+		{65536, 256},
+		{65537, 41}, // 3 przebiegi: 41*41*41 >= 65537
+	}
+
+	for i, tc := range tests {
+		order := morder(tc.nruns)
+		if order != tc.order {
+			t.Errorf("#%d: %d: oczekiwano: %d, jest: %d", i, tc.nruns, tc.order, order)
+		}
+	}
+}
+
+// minLine i linmerge są wersją merge sprzed użycia stogu, w której
+// najmniejszy wiersz jest wybierany przez przeszukiwanie liniowe - do
+// porównania w BenchmarkMerge.
+
+func minLine(lines []string, c *collate.Collator) int {
+	min := -1
+	for i := range lines {
+		if lines[i] == "" {
+			continue
+		}
+		if min == -1 {
+			min = i
+			continue
+		}
+		if compare(lines[i], lines[min], c) < 0 {
+			min = i
+		}
+	}
+	return min
+}
+
+func linmerge(out io.Writer, files []*os.File, c *collate.Collator) error {
+	nf := len(files)
+	bfiles := make([]*bufio.Reader, nf)
+	lines := make([]string, nf)
+	for i, f := range files {
+		bfiles[i] = bufio.NewReader(f)
+		line, err := bfiles[i].ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		lines[i] = line
+	}
+
+	for nf > 0 {
+		i := minLine(lines, c)
+		_, err := io.WriteString(out, lines[i])
+		if err != nil {
+			return err
+		}
+		line, err := bfiles[i].ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		lines[i] = line
+		if len(line) == 0 {
+			nf--
+		}
+	}
+	return nil
+}
+
+// BenchmarkMerge porównuje łączenie plików tymczasowych przy użyciu
+// stogu (merge) i przez przeszukiwanie liniowe (linmerge), dla różnej
+// liczby łączonych plików. Koszt wybrania wiersza przez merge rośnie
+// logarytmicznie, a przez linmerge liniowo z liczbą plików.
+func BenchmarkMerge(b *testing.B) {
+	c := collate.New(language.Polish)
+	type mergefunc func(io.Writer, []*os.File, *collate.Collator) error
+	funcs := []struct {
+		name string
+		f    mergefunc
+	}{
+		{"heap", merge},
+		{"linear", linmerge},
+	}
+
+	for _, n := range []int{5, 50, 250} {
+		files, _ := mkruns(b, b.TempDir(), n, 20000/n)
+		for _, fn := range funcs {
+			b.Run(fmt.Sprintf("%s-%d", fn.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					rewind(b, files)
+					err := fn.f(io.Discard, files, c)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestGtext(t *testing.T) {
+	type test struct {
+		input  string // tekst wejściowy
+		maxmem int64  // pamięć na wiersze
+		nlines []int  // oczekiwane liczby wierszy w kolejnych porcjach
+	}
+	tests := []test{
+		{"", 100, []int{0}},
+		{"a\nb\nc\n", 1, []int{1, 1, 1, 0}},
+		{"a\nb\nc\n", 2 * (2 + linesize), []int{2, 1}},
+		{"a\nb\nc\n", 1000, []int{3}},
+		{"a\nb\nc", 2 * (2 + linesize), []int{2, 1}},
+	}
+
+	for i, tc := range tests {
+		r := bufio.NewReader(strings.NewReader(tc.input))
+		var nlines []int
+		for {
+			lines, err := gtext(r, tc.maxmem)
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			nlines = append(nlines, len(lines))
+			if err == io.EOF {
+				break
+			}
+		}
+		if fmt.Sprint(nlines) != fmt.Sprint(tc.nlines) {
+			t.Errorf("#%d: oczekiwano: %v, jest: %v", i, tc.nlines, nlines)
+		}
+	}
+}
+
+func TestParsesize(t *testing.T) {
+	type test struct {
+		s    string
+		size int64
+		err  bool // czy powinien wystąpić błąd
+	}
+	tests := []test{
+		{"100", 100, false},
+		{"512K", 512 << 10, false},
+		{"512k", 512 << 10, false},
+		{"100M", 100 << 20, false},
+		{"2G", 2 << 30, false},
+		{"0", 0, true},
+		{"", 0, true},
+		{"M", 0, true},
+		{"-1", 0, true},
+		{"1T", 0, true},
+		{"1KB", 0, true},
+		{"1.5M", 0, true},
+		{"99999999999G", 0, true},
+	}
+
+	for i, tc := range tests {
+		size, err := parsesize(tc.s)
+		if tc.err {
+			if err == nil {
+				t.Errorf("#%d: %q: powinien wystąpić błąd", i, tc.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: %q: %s", i, tc.s, err)
+			continue
+		}
+		if size != tc.size {
+			t.Errorf("#%d: %q: oczekiwano: %d, jest: %d", i, tc.s, tc.size, size)
+		}
+	}
+}
+
+func TestQuicksort(t *testing.T) {
+	c := collate.New(language.Polish)
+	const n = 100000
+	rnd := rand.New(rand.NewSource(1))
+	var sorted, equal, random []string
+	for i := 0; i < n; i++ {
+		sorted = append(sorted, fmt.Sprintf("%08d\n", i))
+		equal = append(equal, "abc\n")
+		random = append(random, fmt.Sprintf("%08d\n", rnd.Intn(1000)))
+	}
+	var reversed []string
+	for i := n - 1; i >= 0; i-- {
+		reversed = append(reversed, sorted[i])
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"posortowane", sorted},
+		{"odwrotnie", reversed},
+		{"równe", equal},
+		{"powtórzenia", random},
+	}
+	for _, tc := range tests {
+		a := append([]string(nil), tc.lines...)
+		quicksort(a, c)
+		want := append([]string(nil), tc.lines...)
+		sort.Strings(want)
+		if strings.Join(a, "") != strings.Join(want, "") {
+			t.Errorf("%s: wynik nie jest posortowany", tc.name)
+		}
+	}
+}
+
+func TestRuns(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer func() { memsize = 32 << 20 }()
+	memsize = 1000
+
+	c := collate.New(language.Polish)
+	rnd := rand.New(rand.NewSource(1))
+	var lines []string
+	for i := 0; i < 5000; i++ {
+		lines = append(lines, fmt.Sprintf("%08d\n", rnd.Intn(100000000)))
+	}
+	input := strings.Join(lines, "")
+	sort.Strings(lines)
+	want := strings.Join(lines, "")
+
+	nruns := make(map[string]int)
+	funcs := []struct {
+		name string
+		f    func(*bufio.Reader, *collate.Collator) (int, error)
+	}{
+		{"sortruns", sortruns},
+		{"selruns", selruns},
+	}
+	for _, fn := range funcs {
+		high, err := fn.f(bufio.NewReader(strings.NewReader(input)), c)
+		if err != nil {
+			t.Fatalf("%s: %s", fn.name, err)
+		}
+		nruns[fn.name] = high
+
+		// każda seria jest posortowana i zawiera wiersze z wejścia
+		var all []string
+		for i := 1; i <= high; i++ {
+			data, err := os.ReadFile(gname(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			run := strings.SplitAfter(string(data), "\n")
+			run = run[:len(run)-1]
+			if !sort.StringsAreSorted(run) {
+				t.Errorf("%s: seria %d nie jest posortowana", fn.name, i)
+			}
+			all = append(all, run...)
+			os.Remove(gname(i))
+		}
+		sort.Strings(all)
+		if strings.Join(all, "") != want {
+			t.Errorf("%s: serie zawierają inne wiersze niż wejście", fn.name)
+		}
+	}
+
+	// wybór z zastępowaniem tworzy serie około dwa razy dłuższe
+	if 3*nruns["selruns"] > 2*nruns["sortruns"] {
+		t.Errorf("selruns: za dużo serii: %d (sortruns: %d)",
+			nruns["selruns"], nruns["sortruns"])
+	}
+}
@@ -0,0 +1,257 @@
+// Plik zawiera funkcjonalność związaną z drukowaniem różnic między
+// tekstem przed i po zamianie w formacie unified diff.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Liczba wierszy kontekstu przed i po zmianach we fragmencie (hunk)
+// różnic.
+const diffContext = 3
+
+// Stałe oznaczające rodzaj operacji edycyjnej.
+const (
+	opEq  byte = iota // wiersz bez zmian
+	opDel             // wiersz usunięty
+	opIns             // wiersz wstawiony
+)
+
+// Typ edit opisuje jedną operację skryptu edycyjnego przekształcającego
+// ciąg wierszy a w ciąg wierszy b. Pola a i b zawierają indeksy
+// wierszy w a i b, których dotyczy operacja; dla wiersza wstawionego
+// a jest indeksem wiersza w a, przed którym następuje wstawienie, a
+// dla wiersza usuniętego b jest analogicznym indeksem w b.
+type edit struct {
+	op byte
+	a  int
+	b  int
+}
+
+// splitLines dzieli tekst s na wiersze. Wiersze zawierają kończące je
+// znaki '\n'; ostatni wiersz może nie być zakończony znakiem '\n'.
+func splitLines(s string) []string {
+	var lines []string
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
+
+// diffLines zwraca najkrótszy skrypt edycyjny przekształcający ciąg
+// wierszy a w ciąg wierszy b. Wspólny początek i koniec ciągów jest
+// pomijany przed użyciem algorytmu Myersa, co przyspiesza typowy
+// przypadek, w którym zmienia się niewiele wierszy.
+func diffLines(a, b []string) []edit {
+	pre := 0 // długość wspólnego początku
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0 // długość wspólnego końca
+	for suf < len(a)-pre && suf < len(b)-pre &&
+		a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var es []edit
+	for i := 0; i < pre; i++ {
+		es = append(es, edit{opEq, i, i})
+	}
+	for _, e := range myers(a[pre:len(a)-suf], b[pre:len(b)-suf]) {
+		e.a += pre
+		e.b += pre
+		es = append(es, e)
+	}
+	for i := 0; i < suf; i++ {
+		es = append(es, edit{opEq, len(a) - suf + i, len(b) - suf + i})
+	}
+	return es
+}
+
+// myers zwraca najkrótszy skrypt edycyjny przekształcający a w b
+// obliczony algorytmem Myersa "An O(ND) Difference Algorithm and Its
+// Variations". Dla każdego kroku d zapamiętywany jest fragment
+// tablicy v dla przekątnych -d..d, potrzebny do odtworzenia ścieżki.
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1 // przesunięcie indeksu przekątnej k w v
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		snap := make([]int, 2*d+1)
+		copy(snap, v[off-d:off+d+1])
+		trace = append(trace, snap)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1] // ruch w dół - wstawienie
+			} else {
+				x = v[off+k-1] + 1 // ruch w prawo - usunięcie
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	panic("myers: nie znaleziono ścieżki")
+}
+
+// backtrack odtwarza skrypt edycyjny ze stanów trace zapamiętanych
+// przez funkcję myers, idąc od punktu (n, m) do (0, 0).
+func backtrack(trace [][]int, n, m int) []edit {
+	var rev []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d] // v[k+d] dla przekątnych k z kroku d-1
+		k := x - y
+
+		px, py := 0, 0 // punkt początkowy ruchu w kroku d
+		if d > 0 {
+			pk := k - 1
+			if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+				pk = k + 1
+			}
+			px = v[pk+d]
+			py = px - pk
+		}
+
+		for x > px && y > py {
+			rev = append(rev, edit{opEq, x - 1, y - 1})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == px {
+				rev = append(rev, edit{opIns, x, y - 1})
+			} else {
+				rev = append(rev, edit{opDel, x - 1, y})
+			}
+		}
+		x, y = px, py
+	}
+
+	es := make([]edit, len(rev))
+	for i, e := range rev {
+		es[len(rev)-1-i] = e
+	}
+	return es
+}
+
+// unified drukuje do w różnice między tekstem old i new pliku name w
+// formacie unified diff, akceptowanym przez program patch (patch
+// -p0). Jeśli teksty są jednakowe, to nic nie drukuje.
+func unified(w io.Writer, name string, old, new string) error {
+	a := splitLines(old)
+	b := splitLines(new)
+	es := diffLines(a, b)
+
+	headers := false
+	for i := 0; i < len(es); {
+		// pomiń wiersze bez zmian
+		if es[i].op == opEq {
+			i++
+			continue
+		}
+
+		// fragment zaczyna się diffContext wierszy przed zmianą i
+		// obejmuje następne zmiany odległe o nie więcej niż
+		// 2*diffContext wierszy
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i // indeks za ostatnią zmianą fragmentu
+		for j := i; j < len(es); j++ {
+			if es[j].op != opEq {
+				end = j + 1
+				continue
+			}
+			if j-end >= 2*diffContext {
+				break
+			}
+		}
+		i = end
+		end += diffContext
+		if end > len(es) {
+			end = len(es)
+		}
+
+		if !headers {
+			_, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", name, name)
+			if err != nil {
+				return err
+			}
+			headers = true
+		}
+		err := hunk(w, es[start:end], a, b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hunk drukuje do w jeden fragment różnic zawierający operacje es.
+func hunk(w io.Writer, es []edit, a, b []string) error {
+	na, nb := 0, 0 // liczba wierszy fragmentu w a i b
+	for _, e := range es {
+		if e.op != opIns {
+			na++
+		}
+		if e.op != opDel {
+			nb++
+		}
+	}
+
+	// dla pustego zakresu numer wiersza wskazuje wiersz poprzedzający
+	sa, sb := es[0].a, es[0].b
+	if na > 0 {
+		sa++
+	}
+	if nb > 0 {
+		sb++
+	}
+	_, err := fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", sa, na, sb, nb)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range es {
+		var line string
+		var c byte
+		switch e.op {
+		case opEq:
+			line, c = a[e.a], ' '
+		case opDel:
+			line, c = a[e.a], '-'
+		case opIns:
+			line, c = b[e.b], '+'
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n\\ No newline at end of file\n"
+		}
+		_, err := fmt.Fprintf(w, "%c%s", c, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -12,6 +12,9 @@ change - zamienia wzorce w tekście
 SPOSÓB UŻYCIA
 
 change <pattern> [<substitution>]
+change -i[suffix] <pattern> <substitution> <file> ...
+change -n <pattern> <substitution> <file> ...
+change -f <rules> [-i[suffix] | -n] [<file> ...]
 
 OPIS
 
@@ -25,14 +28,110 @@ zawiera znaki '&' to te znaki są zastępowane fragmentem pasującym
 do <pattern>.  Żeby znak '&' pozbawić specjalnego znaczenia,
 należy zamiast niego użyć sekwencji '@&'.
 
+Opcja -i powoduje, że zamiast czytania standardowego wejścia
+zmieniane są w miejscu podane pliki; argument <substitution> jest
+wtedy wymagany (może być pustym stringiem ""). Jeśli bezpośrednio po
+-i podano suffix (np. -i.bak lub -i=.bak), to pierwotna zawartość
+każdego zmienianego pliku jest zachowywana w pliku o nazwie z
+dodanym suffiksem. Nowa zawartość jest zapisywana do pliku
+tymczasowego w tym samym katalogu, synchronizowana na dysk i
+przemianowywana na nazwę pliku, więc przerwanie programu nie
+uszkadza pliku. Prawa dostępu pliku są zachowywane. Pliki, w których
+nic nie zostało zamienione, nie są zapisywane, więc czas ich
+modyfikacji się nie zmienia. W trybie -i znaki końca wiersza są
+zachowywane i długość wiersza nie jest ograniczona.
+
+Opcja -n (lub -diff) powoduje, że podane pliki nie są zmieniane, a na
+standardowe wyjście są drukowane zmiany, które zostałyby wykonane, w
+formacie unified diff: nagłówki z nazwą pliku i fragmenty (hunk)
+zmian z trzema wierszami kontekstu. Wynik może być użyty przez
+program patch:
+
+	change -n kot pies *.txt >zmiany.diff
+	patch -p0 <zmiany.diff
+
+Opcja -f powoduje, że zamiast argumentów <pattern> i <substitution>
+używane są reguły zamiany wczytane z pliku <rules>. Każdy wiersz
+pliku zawiera jedną regułę postaci:
+
+	/pattern/substitution/
+
+gdzie zamiast '/' może być użyty dowolny znak (ogranicznik) nie
+będący literą, cyfrą, odstępem, znakiem '#' ani '@'. Ostatni
+ogranicznik może być pominięty. Ogranicznik występujący we wzorcu lub
+tekście zastępującym należy poprzedzić znakiem '@'. Wiersze puste i
+zaczynające się od znaku '#' (komentarze) są pomijane. Każda reguła
+jest kompilowana raz, a wszystkie reguły są stosowane do każdego
+wiersza w kolejności występowania w pliku - każda do wyniku
+poprzedniej. Błędy w pliku reguł są zgłaszane z numerem wiersza.
+Przykładowy plik reguł:
+
+	# zamiana polskich znaków na ASCII
+	/ą/a/
+	/ę/e/
+	|ó|o|
+
+Zakres zamian można ograniczyć opcjami:
+
+	-o n		zamienia tylko n-te wystąpienie wzorca w każdym
+			wierszu (pozostałe wystąpienia są kopiowane bez
+			zmian)
+	-m n		zamienia łącznie co najwyżej n fragmentów, we
+			wszystkich plikach razem
+	-g addr		zmienia tylko wiersze pasujące do wzorca addr
+			(jak dyrektywa g/addr/s/// w edytorze edit); wzorzec
+			addr ma taką samą składnię jak <pattern>
+	-stats		drukuje na stderr liczbę zamian w każdym pliku
+			(postaci "nazwa: liczba"; dla stdin nazwą jest "-")
+
+Opcja -c (lub -case) włącza tryb zachowania wielkości liter: wzorzec
+jest dopasowywany bez względu na wielkość liter, a tekst zastępujący,
+po zastąpieniu znaków '&' dopasowanym fragmentem, otrzymuje wielkość
+liter dopasowanego fragmentu. Jeśli dopasowany fragment zawiera same
+małe litery, to tekst zastępujący jest zamieniany na małe litery;
+jeśli same wielkie (co najmniej dwie) - na wielkie; jeśli tylko
+pierwsza litera jest wielka - pierwsza litera tekstu zastępującego
+jest zamieniana na wielką, a pozostałe litery jej słowa na małe. W
+pozostałych przypadkach (np. "fooBar") tekst zastępujący nie jest
+zmieniany. Wielkość liter jest rozpoznawana dla wszystkich liter
+Unicode, w tym polskich. Opcja jest przydatna przy zmianie nazw
+identyfikatorów:
+
+	change -c foo bar <plik
+
+zamienia "foo" na "bar", "Foo" na "Bar" i "FOO" na "BAR".
+
+Opcje -w i -p włączają tryb wielowierszowy, w którym wzorce są
+dopasowywane do bloków tekstu zawierających wiele wierszy, a nie do
+pojedynczych wierszy. Z opcją -w blokiem jest całe wejście (lub cały
+plik), a z opcją -p każdy akapit, czyli ciąg niepustych wierszy;
+puste wiersze oddzielające akapity nie są zmieniane. Końcowy znak
+'\n' bloku nie należy do niego (tak jak w trybie zwykłym znak '\n'
+nie należy do wiersza). W tym trybie '@n' pasuje do wewnętrznych
+znaków nowego wiersza, '%' do początku bloku i do pozycji po każdym
+wewnętrznym znaku nowego wiersza, a '$' do pozycji przed każdym
+wewnętrznym znakiem nowego wiersza i do końca bloku - czyli '%' i
+'$' pasują do początku i końca każdego wiersza bloku. Znaki '?' i
+[^...] nie pasują do znaku nowego wiersza. Opcje -o, -g i -c dotyczą
+wtedy całego bloku. Na przykład połączenie wierszy w każdym akapicie
+w jeden wiersz:
+
+	change -p @n ' ' <plik
+
+Na przykład zamiana tylko pierwszego wystąpienia słowa "kot" w
+wierszach zawierających "Ala":
+
+	change -o 1 -g Ala kot pies <plik
+
 UWAGI
 
 Jeśli ostatni wiersz wejściowy nie jest zakończony znakiem '\n',
-to na wyjściu zostanie dodany do niego znak '\n'.
+to na wyjściu zostanie dodany do niego znak '\n' (nie dotyczy opcji
+-i, -n, -w i -p).
 
 Ograniczenie na długość wiersza wejściowego wynosi około 64
 KB.  Jeśli wiersz jest za długi to zostanie zgłoszony błąd
-'token too long'.
+'token too long' (nie dotyczy opcji -i, -n, -w i -p).
 
 */
 package main
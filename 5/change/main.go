@@ -10,6 +10,9 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/adbr/npwp/5/pattern"
@@ -22,10 +25,42 @@ const s_ditto = '&'
 // Wartość różna od kodów zwykłych znaków.
 const ditto = 0
 
-var usageStr = "sposób użycia: change <pattern> [<substitution>]"
+var (
+	occurrence int             // numer zamienianego wystąpienia w wierszu (0 - wszystkie)
+	limit      int             // maksymalna łączna liczba zamian (0 - bez ograniczenia)
+	address    pattern.Pattern // wzorzec wybierający zmieniane wiersze
+	hasAddress bool            // czy podano wzorzec address
+	nsubs      int             // łączna liczba wykonanych zamian
+	keepCase   bool            // czy zachowywać wielkość liter dopasowania
+	mode       int             // sposób podziału tekstu na bloki
+)
+
+// Stałe oznaczające sposób podziału tekstu na bloki, w których są
+// zamieniane wzorce.
+const (
+	modeLine  = iota // każdy wiersz osobno
+	modePara         // akapity oddzielone pustymi wierszami
+	modeWhole        // cały tekst jako jeden blok
+)
+
+// Stałe oznaczające rodzaj wielkości liter w tekście.
+const (
+	caseMixed = iota // różne lub brak liter
+	caseLower        // wszystkie litery małe: "foo"
+	caseUpper        // wszystkie litery wielkie: "FOO"
+	caseTitle        // pierwsza litera wielka, pozostałe małe: "Foo"
+)
+
+var usageStr = `sposób użycia: change <pattern> [<substitution>]
+               change -i[suffix] <pattern> <substitution> <file> ...
+               change -n <pattern> <substitution> <file> ...
+               change -f <rules> [-i[suffix] | -n] [<file> ...]`
 
 var helpStr = `Program zamienia wzorce w tekście.
 sposób użycia: change <pattern> [<substitution>]
+               change -i[suffix] <pattern> <substitution> <file> ...
+               change -n <pattern> <substitution> <file> ...
+               change -f <rules> [-i[suffix] | -n] [<file> ...]
 
 Program change czyta wiersze tekstu ze standardowego wejścia,
 zamienia wszystkie nie nakładające się fragmenty pasujące do
@@ -36,8 +71,100 @@ pasujący do <pattern> jest usuwany. Jeśli argument <substitution>
 zawiera znaki '&' to te znaki są zastępowane fragmentem pasującym
 do <pattern>.  Żeby znak '&' pozbawić specjalnego znaczenia,
 należy zamiast niego użyć sekwencji '@&'.
+
+Opcja -i powoduje, że zamiast czytania stdin zmieniane są w miejscu
+podane pliki. Jeśli podano suffix (np. -i.bak lub -i=.bak), to
+pierwotna zawartość pliku jest zachowywana w pliku o nazwie z
+dodanym suffiksem. Pliki, w których nic nie zostało zamienione, nie
+są zapisywane.
+
+Opcja -n (lub -diff) powoduje, że pliki nie są zmieniane, a na
+standardowe wyjście drukowane są zmiany, które zostałyby wykonane,
+w formacie unified diff (do użycia przez program patch -p0).
+
+Opcja -f powoduje, że zamiast argumentów <pattern> i <substitution>
+używane są reguły zamiany z pliku <rules>, po jednej w wierszu, w
+postaci /pattern/substitution/ (zamiast '/' może być inny znak).
+Wiersze puste i zaczynające się od '#' są pomijane. Reguły są
+stosowane do każdego wiersza kolejno.
+
+Opcje:
+  -o n      zamienia tylko n-te wystąpienie wzorca w każdym wierszu
+  -m n      zamienia łącznie co najwyżej n fragmentów
+  -g addr   zmienia tylko wiersze pasujące do wzorca addr
+  -stats    drukuje na stderr liczbę zamian w każdym pliku
+  -c        dopasowuje wzorzec bez względu na wielkość liter i
+            zachowuje wielkość liter dopasowanego fragmentu
+            (foo -> bar, Foo -> Bar, FOO -> BAR)
+  -w        traktuje cały tekst jako jeden wiersz (wzorce mogą
+            obejmować wiele wierszy, '@n' pasuje do wewnętrznych
+            znaków nowego wiersza, '%' i '$' do początku i końca
+            każdego wiersza)
+  -p        jak -w, ale osobno dla każdego akapitu (ciągu
+            niepustych wierszy)
 `
 
+// Typ inplaceFlag jest wartością opcji -i. Opcja może wystąpić bez
+// wartości (-i) lub z suffiksem nazwy pliku kopii zapasowej (-i=.bak).
+// Implementuje interfejs flag.Value.
+type inplaceFlag struct {
+	set    bool   // czy opcja wystąpiła
+	suffix string // suffix nazwy kopii zapasowej
+}
+
+func (f *inplaceFlag) String() string {
+	return f.suffix
+}
+
+func (f *inplaceFlag) Set(s string) error {
+	switch s {
+	case "true":
+		f.set = true
+	case "false":
+		f.set = false
+	default:
+		f.set = true
+		f.suffix = s
+	}
+	return nil
+}
+
+func (f *inplaceFlag) IsBoolFlag() bool {
+	return true
+}
+
+// inplaceArgs zamienia w args argumenty postaci -i.bak na -i=.bak,
+// ponieważ pakiet flag nie obsługuje wartości opcji zapisanej bez
+// znaku '='. Opcje są rozpoznawane tak jak w fs: wartości opcji
+// nie będących opcjami logicznymi (np. -f rules) są pomijane.
+func inplaceArgs(fs *flag.FlagSet, args []string) []string {
+	out := make([]string, len(args))
+	copy(out, args)
+	for i := 0; i < len(out); i++ {
+		a := out[i]
+		if a == "--" || !strings.HasPrefix(a, "-") {
+			break
+		}
+		if strings.HasPrefix(a, "-i") && len(a) > 2 && a[2] != '=' {
+			out[i] = "-i=" + a[2:]
+			continue
+		}
+		name := strings.TrimLeft(a, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			continue
+		}
+		i++ // wartość opcji
+	}
+	return out
+}
+
 func usage() {
 	fmt.Fprintln(os.Stderr, usageStr)
 	os.Exit(1)
@@ -99,40 +226,144 @@ func subpart(match string, sub string) (string, error) {
 	return string(new), nil
 }
 
+// caseOf zwraca rodzaj wielkości liter w tekście s. Znaki nie będące
+// literami są pomijane. Pojedyncza wielka litera jest traktowana jak
+// caseTitle.
+func caseOf(s string) int {
+	nupper, nlower := 0, 0
+	firstUpper := false // czy pierwsza litera jest wielka
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			if nupper+nlower == 0 {
+				firstUpper = true
+			}
+			nupper++
+		} else if unicode.IsLower(r) {
+			nlower++
+		}
+	}
+	switch {
+	case nupper == 0 && nlower == 0:
+		return caseMixed
+	case nupper == 0:
+		return caseLower
+	case firstUpper && nupper == 1:
+		return caseTitle
+	case nlower == 0:
+		return caseUpper
+	default:
+		return caseMixed
+	}
+}
+
+// matchCase zwraca tekst s z wielkością liter taką jak w dopasowanym
+// fragmencie match: małe, wielkie lub pierwsza litera wielka. W
+// ostatnim przypadku pierwsza litera s jest zamieniana na wielką, a
+// pozostałe litery jej słowa na małe. Jeśli match zawiera litery
+// różnej wielkości (np. "fooBar") lub nie zawiera liter, to s jest
+// zwracany bez zmian.
+func matchCase(match, s string) string {
+	switch caseOf(match) {
+	case caseLower:
+		return strings.ToLower(s)
+	case caseUpper:
+		return strings.ToUpper(s)
+	case caseTitle:
+		i := strings.IndexFunc(s, unicode.IsLetter)
+		if i < 0 {
+			return s
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		j := i + n // koniec słowa
+		for j < len(s) {
+			r, n := utf8.DecodeRuneInString(s[j:])
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			j += n
+		}
+		return s[:i] + string(unicode.ToUpper(r)) + strings.ToLower(s[i+n:j]) + s[j:]
+	}
+	return s
+}
+
+// subline zamienia w wierszu line nie nakładające się fragmenty
+// pasujące do pat na sub. Jeśli occurrence > 0, to zamieniane jest
+// tylko occurrence-te wystąpienie wzorca w wierszu. Jeśli limit > 0,
+// to łączna liczba zamian (licznik nsubs) nie przekroczy limit.
+// Puste dopasowanie bezpośrednio po poprzednim dopasowaniu jest
+// pomijane (jak w książce), więc np. wzorzec "a*" nie powoduje
+// dodatkowej zamiany za każdym ciągiem liter 'a'. Jeśli ustawiona jest
+// opcja keepCase, to tekst zastępujący (po rozwinięciu znaków '&')
+// otrzymuje wielkość liter dopasowanego fragmentu.
 func subline(line string, pat pattern.Pattern, sub string) (string, error) {
 	var new []byte
-	var i int = 0 // indeks początku dopasowania w line
-	for {
-		if i >= len(line) {
-			break
-		}
+	occ := 0    // liczba wystąpień wzorca w wierszu
+	lastm := -1 // indeks końca ostatniego dopasowania
+
+	// i - indeks początku dopasowania w line; dopasowanie jest
+	// sprawdzane także na końcu wiersza (może być puste)
+	for i := 0; i <= len(line); {
 		ok, n := pattern.Amatch(line, i, pat, 0)
-		if ok {
-			s, err := subpart(line[i:i+n], sub)
-			if err != nil {
-				return string(new), err
+		if ok && i+n != lastm {
+			occ++
+			if (occurrence == 0 || occ == occurrence) &&
+				(limit == 0 || nsubs < limit) {
+				s, err := subpart(line[i:i+n], sub)
+				if err != nil {
+					return string(new), err
+				}
+				if keepCase {
+					s = matchCase(line[i:i+n], s)
+				}
+				new = append(new, s...)
+				nsubs++
+			} else {
+				new = append(new, line[i:i+n]...)
 			}
-			new = append(new, s...)
+			lastm = i + n
+		}
+		if i == len(line) {
+			break
+		}
+		if ok && n > 0 {
 			i += n
-		} else {
-			r, rn := utf8.DecodeRuneInString(line[i:])
-			if r == utf8.RuneError {
-				err := errors.New("subline: błąd dekodowania znaku utf8")
-				return string(new), err
-			}
-			new = append(new, line[i:i+rn]...)
-			i += rn
+			continue
 		}
+		r, rn := utf8.DecodeRuneInString(line[i:])
+		if r == utf8.RuneError {
+			err := errors.New("subline: błąd dekodowania znaku utf8")
+			return string(new), err
+		}
+		new = append(new, line[i:i+rn]...)
+		i += rn
 	}
 
 	return string(new), nil
 }
 
-func change(w io.Writer, r io.Reader, pat pattern.Pattern, sub string) error {
+// change czyta wiersze z r, zamienia w nich fragmenty pasujące do
+// wzorców reguł rules i zapisuje wynik do w. W trybie wielowierszowym
+// (mode różne od modeLine) czyta całe wejście i przetwarza je funkcją
+// subtext.
+func change(w io.Writer, r io.Reader, rules []rule) error {
+	if mode != modeLine {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		new, err := subtext(string(data), rules)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, new)
+		return err
+	}
+
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
-		new, err := subline(line, pat, sub)
+		new, err := sublines(line, rules)
 		if err != nil {
 			return err
 		}
@@ -147,35 +378,288 @@ func change(w io.Writer, r io.Reader, pat pattern.Pattern, sub string) error {
 	return nil
 }
 
+// subtext zamienia fragmenty pasujące do wzorców reguł rules we
+// wszystkich blokach tekstu text (wierszach, akapitach lub całym
+// tekście, zależnie od mode). W odróżnieniu od change zachowuje znaki
+// końca wiersza - ostatni wiersz nie zakończony znakiem '\n'
+// pozostaje bez tego znaku - i nie ogranicza długości wiersza.
+func subtext(text string, rules []rule) (string, error) {
+	var b strings.Builder
+	for len(text) > 0 {
+		block, sep, rest := splitBlock(text)
+		text = rest
+		if block == "" && mode == modePara {
+			// puste wiersze przed pierwszym akapitem
+			b.WriteString(sep)
+			continue
+		}
+		new, err := sublines(block, rules)
+		if err != nil {
+			return b.String(), err
+		}
+		b.WriteString(new)
+		b.WriteString(sep)
+	}
+	return b.String(), nil
+}
+
+// splitBlock zwraca pierwszy blok tekstu text, w którym są zamieniane
+// wzorce, separator kończący blok i pozostałą część tekstu. Blokiem
+// jest, zależnie od mode, wiersz, akapit (ciąg niepustych wierszy) lub
+// cały tekst. Blok nie zawiera końcowego znaku '\n' - należy on do
+// separatora, razem z pustymi wierszami oddzielającymi akapity.
+func splitBlock(text string) (block, sep, rest string) {
+	switch mode {
+	case modeWhole:
+		if strings.HasSuffix(text, "\n") {
+			return text[:len(text)-1], "\n", ""
+		}
+		return text, "", ""
+	case modePara:
+		if text[0] == '\n' {
+			i := strings.IndexFunc(text, func(r rune) bool { return r != '\n' })
+			if i < 0 {
+				i = len(text)
+			}
+			return "", text[:i], text[i:]
+		}
+		j := strings.Index(text, "\n\n")
+		if j < 0 {
+			if strings.HasSuffix(text, "\n") {
+				return text[:len(text)-1], "\n", ""
+			}
+			return text, "", ""
+		}
+		k := j
+		for k < len(text) && text[k] == '\n' {
+			k++
+		}
+		return text[:j], text[j:k], text[k:]
+	default:
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			return text[:i], "\n", text[i+1:]
+		}
+		return text, "", ""
+	}
+}
+
+// editFile zamienia w miejscu fragmenty pasujące do wzorców reguł
+// rules w pliku fname. Jeśli suffix nie jest pusty, to pierwotna zawartość
+// pliku jest zapisywana w pliku fname+suffix. Jeśli nic nie zostało
+// zamienione, to plik nie jest zapisywany (nie zmienia się czas jego
+// modyfikacji).
+func editFile(fname string, rules []rule, suffix string) error {
+	fi, data, err := readFile(fname)
+	if err != nil {
+		return err
+	}
+
+	new, err := subtext(string(data), rules)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fname, err)
+	}
+	if new == string(data) {
+		return nil
+	}
+
+	perm := fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if suffix != "" {
+		err := writeFile(fname+suffix, data, perm)
+		if err != nil {
+			return err
+		}
+	}
+	return writeFile(fname, []byte(new), perm)
+}
+
+// diffFile drukuje do w, w formacie unified diff, zmiany jakie
+// spowodowałaby zamiana fragmentów pasujących do wzorców reguł rules
+// w pliku fname. Plik nie jest zmieniany.
+func diffFile(w io.Writer, fname string, rules []rule) error {
+	_, data, err := readFile(fname)
+	if err != nil {
+		return err
+	}
+
+	new, err := subtext(string(data), rules)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fname, err)
+	}
+	return unified(w, fname, string(data), new)
+}
+
+// readFile zwraca informacje o pliku fname i jego zawartość. Zwraca
+// błąd jeśli fname nie jest zwykłym plikiem.
+func readFile(fname string) (os.FileInfo, []byte, error) {
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("%s: nie jest zwykłym plikiem", fname)
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fi, data, nil
+}
+
+// writeFile atomowo zastępuje zawartość pliku fname przez data.
+// Dane są zapisywane do pliku tymczasowego w katalogu pliku fname,
+// synchronizowane na dysk (fsync), a następnie plik tymczasowy jest
+// przemianowywany na fname. W przypadku błędu plik fname pozostaje
+// niezmieniony. Nowy plik ma prawa dostępu perm.
+func writeFile(fname string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(fname)
+	if dir == "" {
+		dir = "."
+	}
+	t, err := os.CreateTemp(dir, "."+base+".change")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// po udanym Rename plik tymczasowy już nie istnieje
+		t.Close()
+		os.Remove(t.Name())
+	}()
+
+	_, err = t.Write(data)
+	if err != nil {
+		return err
+	}
+	err = t.Sync()
+	if err != nil {
+		return err
+	}
+	err = t.Chmod(perm)
+	if err != nil {
+		return err
+	}
+	err = t.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(t.Name(), fname)
+}
+
 func main() {
+	var inplace inplaceFlag
 	helpFlag := flag.Bool("h", false, "wyświetla help")
 	flag.BoolVar(helpFlag, "help", false, "wyświetla help")
+	flag.Var(&inplace, "i", "zmienia pliki w miejscu, z opcjonalnym suffiksem kopii zapasowej")
+	diffFlag := flag.Bool("n", false, "drukuje zmiany w formacie unified diff zamiast zmieniać pliki")
+	flag.BoolVar(diffFlag, "diff", false, "drukuje zmiany w formacie unified diff zamiast zmieniać pliki")
+	rulesFile := flag.String("f", "", "czyta reguły zamiany z pliku")
+	flag.IntVar(&occurrence, "o", 0, "zamienia tylko n-te wystąpienie wzorca w wierszu")
+	flag.IntVar(&limit, "m", 0, "maksymalna łączna liczba zamian")
+	addr := flag.String("g", "", "zmienia tylko wiersze pasujące do wzorca")
+	stats := flag.Bool("stats", false, "drukuje na stderr liczbę zamian w każdym pliku")
+	flag.BoolVar(&keepCase, "c", false, "dopasowuje bez względu na wielkość liter i ją zachowuje")
+	flag.BoolVar(&keepCase, "case", false, "dopasowuje bez względu na wielkość liter i ją zachowuje")
+	whole := flag.Bool("w", false, "dopasowuje wzorce w całym tekście, ponad granicami wierszy")
+	para := flag.Bool("p", false, "dopasowuje wzorce w akapitach, ponad granicami wierszy")
 	flag.Usage = usage
-	flag.Parse()
+	flag.CommandLine.Parse(inplaceArgs(flag.CommandLine, os.Args[1:]))
 
 	if *helpFlag {
 		help()
 	}
 
-	if flag.NArg() < 1 {
-		fmt.Fprintln(os.Stderr, "zła liczba argumentów")
+	switch {
+	case *whole && *para:
+		fmt.Fprintln(os.Stderr, "opcje -w i -p wykluczają się")
 		usage()
+	case *whole:
+		mode = modeWhole
+	case *para:
+		mode = modePara
 	}
-	pat, err := pattern.Makepat(flag.Arg(0))
-	if err != nil {
-		log.Fatal(err)
+	if occurrence < 0 || limit < 0 {
+		fmt.Fprintln(os.Stderr, "wartości opcji -o i -m nie mogą być ujemne")
+		usage()
+	}
+	if *addr != "" {
+		var err error
+		address, err = pattern.Makepat(*addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if mode != modeLine {
+			address = pattern.Multiline(address)
+		}
+		hasAddress = true
 	}
 
-	sub := ""
-	if flag.NArg() >= 2 {
-		sub, err = getsub(flag.Arg(1))
+	var rules []rule
+	args := flag.Args()
+	if *rulesFile != "" {
+		var err error
+		rules, err = readRules(*rulesFile)
 		if err != nil {
 			log.Fatal(err)
 		}
+	} else {
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "zła liczba argumentów")
+			usage()
+		}
+		sub := ""
+		if len(args) >= 2 {
+			sub = args[1]
+		}
+		r, err := newRule(args[0], sub)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rules = append(rules, r)
+		if len(args) >= 2 {
+			args = args[2:]
+		} else {
+			args = nil
+		}
 	}
 
-	err = change(os.Stdout, os.Stdin, pat, sub)
+	if inplace.set || *diffFlag {
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "opcje -i i -n wymagają podania plików")
+			usage()
+		}
+		w := bufio.NewWriter(os.Stdout)
+		status := 0
+		for _, fname := range args {
+			var err error
+			n := nsubs
+			if *diffFlag {
+				err = diffFile(w, fname, rules)
+			} else {
+				err = editFile(fname, rules, inplace.suffix)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "change: %s\n", err)
+				status = 1
+			}
+			if *stats {
+				fmt.Fprintf(os.Stderr, "%s: %d\n", fname, nsubs-n)
+			}
+		}
+		err := w.Flush()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(status)
+	}
+
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "zła liczba argumentów")
+		usage()
+	}
+	err := change(os.Stdout, os.Stdin, rules)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *stats {
+		fmt.Fprintf(os.Stderr, "-: %d\n", nsubs)
+	}
 }
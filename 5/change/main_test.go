@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adbr/npwp/5/pattern"
+)
+
+func TestSubtext(t *testing.T) {
+	tests := []struct {
+		text string
+		pat  string
+		sub  string
+		out  string
+	}{
+		{"", "a", "x", ""},
+		{"abc\n", "b", "x", "axc\n"},
+		// ostatni wiersz bez znaku '\n'
+		{"abc\nabc", "b", "x", "axc\naxc"},
+		{"abc\n\n", "b", "&&", "abbc\n\n"},
+		{"abc\n", "c$", "x", "abc\n"},
+	}
+
+	for i, tc := range tests {
+		r, err := newRule(tc.pat, tc.sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := subtext(tc.text, []rule{r})
+		if err != nil {
+			t.Error(err)
+		}
+		if out != tc.out {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, tc.out, out)
+		}
+	}
+}
+
+func TestInplaceArgs(t *testing.T) {
+	tests := []struct {
+		in  []string
+		out []string
+	}{
+		{[]string{"-i", "a", "b"}, []string{"-i", "a", "b"}},
+		{[]string{"-i.bak", "a"}, []string{"-i=.bak", "a"}},
+		{[]string{"-i=.bak", "a"}, []string{"-i=.bak", "a"}},
+		{[]string{"-h", "-i~", "a"}, []string{"-h", "-i=~", "a"}},
+		{[]string{"a", "-i.bak"}, []string{"a", "-i.bak"}},
+		{[]string{"--", "-i.bak"}, []string{"--", "-i.bak"}},
+		{[]string{"-f", "r.txt", "-i.bak", "a"}, []string{"-f", "r.txt", "-i=.bak", "a"}},
+		{[]string{"-o", "2", "-i.bak", "foo", "X", "a"}, []string{"-o", "2", "-i=.bak", "foo", "X", "a"}},
+		{[]string{"--o", "2", "-i~", "a"}, []string{"--o", "2", "-i=~", "a"}},
+		{[]string{"-o=2", "-i~", "a"}, []string{"-o=2", "-i=~", "a"}},
+		{[]string{"-f", "-i.bak", "a"}, []string{"-f", "-i.bak", "a"}},
+	}
+
+	fs := flag.NewFlagSet("change", flag.ContinueOnError)
+	var inplace inplaceFlag
+	fs.Var(&inplace, "i", "")
+	fs.Bool("h", false, "")
+	fs.String("f", "", "")
+	fs.Int("o", 0, "")
+
+	for i, tc := range tests {
+		out := inplaceArgs(fs, tc.in)
+		if !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, tc.out, out)
+		}
+	}
+}
+
+func TestEditFile(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	err := os.WriteFile(a, []byte("ala ma kota\nkot"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(b, []byte("pies\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = os.Chtimes(b, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := newRule("kot", "pies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []rule{r}
+
+	// plik zmieniony, z kopią zapasową
+	err = editFile(a, rules, ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ala ma piesa\npies" {
+		t.Errorf("zła zawartość pliku: %q", data)
+	}
+	data, err = os.ReadFile(a + ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ala ma kota\nkot" {
+		t.Errorf("zła zawartość kopii zapasowej: %q", data)
+	}
+	fi, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("prawa dostępu: oczekiwano: %v, jest: %v",
+			os.FileMode(0640), fi.Mode().Perm())
+	}
+
+	// plik bez zmian nie jest zapisywany
+	err = editFile(b, rules, ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err = os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(old) {
+		t.Errorf("plik bez zmian został zapisany")
+	}
+	_, err = os.Stat(b + ".bak")
+	if !os.IsNotExist(err) {
+		t.Errorf("utworzono kopię zapasową pliku bez zmian")
+	}
+
+	// w katalogu nie mogą pozostać pliki tymczasowe
+	names, err := filepath.Glob(filepath.Join(dir, ".*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("pozostały pliki tymczasowe: %q", names)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		old  string
+		new  string
+		diff string
+	}{
+		{"a\n", "a\n", ""},
+		{
+			"a\nb\nc\n",
+			"a\nx\nc\n",
+			"--- f\n+++ f\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			// zmiany odległe o więcej niż 2*diffContext wierszy
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"1\nx\n3\n4\n5\n6\n7\n8\n9\n10\ny\n12\n",
+			"--- f\n+++ f\n" +
+				"@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n" +
+				"@@ -8,5 +8,5 @@\n 8\n 9\n 10\n-11\n+y\n 12\n",
+		},
+		{
+			// zmiany odległe o 2*diffContext wierszy są łączone
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"x\n2\n3\n4\n5\n6\n7\ny\n9\n",
+			"--- f\n+++ f\n@@ -1,9 +1,9 @@\n" +
+				"-1\n+x\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n 9\n",
+		},
+		{
+			// brak znaku '\n' na końcu
+			"a\nb",
+			"a\nc",
+			"--- f\n+++ f\n@@ -1,2 +1,2 @@\n a\n-b\n" +
+				"\\ No newline at end of file\n+c\n" +
+				"\\ No newline at end of file\n",
+		},
+		{
+			// wstawienie i usunięcie wierszy
+			"a\nb\nc\n",
+			"a\nc\nd\ne\n",
+			"--- f\n+++ f\n@@ -1,3 +1,4 @@\n a\n-b\n c\n+d\n+e\n",
+		},
+		{
+			"",
+			"a\n",
+			"--- f\n+++ f\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			"a\n",
+			"",
+			"--- f\n+++ f\n@@ -1,1 +0,0 @@\n-a\n",
+		},
+	}
+
+	for i, tc := range tests {
+		w := new(bytes.Buffer)
+		err := unified(w, "f", tc.old, tc.new)
+		if err != nil {
+			t.Error(err)
+		}
+		if w.String() != tc.diff {
+			t.Errorf("#%d: oczekiwano:\n%s\njest:\n%s", i, tc.diff, w.String())
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	// skrypt edycyjny musi przekształcać a w b
+	tests := []struct {
+		a string
+		b string
+	}{
+		{"", ""},
+		{"a\nb\nc\n", "a\nb\nc\n"},
+		{"a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n"},
+		{"x\ny\n", "a\nb\nc\n"},
+		{"a\n", ""},
+	}
+
+	for i, tc := range tests {
+		a := splitLines(tc.a)
+		b := splitLines(tc.b)
+		var out []string
+		for _, e := range diffLines(a, b) {
+			switch e.op {
+			case opEq:
+				if a[e.a] != b[e.b] {
+					t.Errorf("#%d: różne wiersze: %q, %q", i, a[e.a], b[e.b])
+				}
+				out = append(out, a[e.a])
+			case opIns:
+				out = append(out, b[e.b])
+			}
+		}
+		if strings.Join(out, "") != tc.b {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, tc.b, strings.Join(out, ""))
+		}
+	}
+}
+
+func TestSubline(t *testing.T) {
+	defer func() {
+		occurrence = 0
+		limit = 0
+		nsubs = 0
+	}()
+
+	tests := []struct {
+		line  string
+		pat   string
+		sub   string
+		occ   int // occurrence
+		limit int
+		out   string
+		nsubs int // oczekiwana liczba zamian
+	}{
+		{"abcabc", "b", "x", 0, 0, "axcaxc", 2},
+		{"abcabc", "b", "[&]", 0, 0, "a[b]ca[b]c", 2},
+		{"abcabc", "b", "x", 1, 0, "axcabc", 1},
+		{"abcabc", "b", "x", 2, 0, "abcaxc", 1},
+		{"abcabc", "b", "x", 3, 0, "abcabc", 0},
+		{"abababab", "b", "x", 0, 3, "axaxaxab", 3},
+		{"abababab", "b", "x", 2, 1, "abaxabab", 1},
+		// puste dopasowania
+		{"bc", "a*", "x", 0, 0, "xbxcx", 3},
+		{"baac", "a*", "x", 0, 0, "xbxcx", 3},
+		{"", "a*", "x", 0, 0, "x", 1},
+		// domknięcie klasy dopełnionej do końca wiersza
+		{"ab", "[^a]*", "x", 0, 0, "xax", 2},
+	}
+
+	for i, tc := range tests {
+		occurrence = tc.occ
+		limit = tc.limit
+		nsubs = 0
+		r, err := newRule(tc.pat, tc.sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := subline(tc.line, r.pat, r.sub)
+		if err != nil {
+			t.Error(err)
+		}
+		if out != tc.out || nsubs != tc.nsubs {
+			t.Errorf("#%d: oczekiwano: %q, %d, jest: %q, %d",
+				i, tc.out, tc.nsubs, out, nsubs)
+		}
+	}
+}
+
+func TestAddress(t *testing.T) {
+	defer func() {
+		address = ""
+		hasAddress = false
+	}()
+
+	r, err := newRule("kot", "pies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err = pattern.Makepat("Ala$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasAddress = true
+
+	out, err := subtext("kot Ala\nkot Ola\nAla kot\n", []rule{r})
+	if err != nil {
+		t.Error(err)
+	}
+	exp := "pies Ala\nkot Ola\nAla kot\n"
+	if out != exp {
+		t.Errorf("oczekiwano: %q, jest: %q", exp, out)
+	}
+}
+
+func TestMatchCase(t *testing.T) {
+	tests := []struct {
+		match string
+		s     string
+		out   string
+	}{
+		{"foo", "bar", "bar"},
+		{"foo", "Bar", "bar"},
+		{"Foo", "bar", "Bar"},
+		{"FOO", "bar", "BAR"},
+		{"F", "bar", "Bar"},
+		{"fooBar", "baz", "baz"},
+		{"123", "Baz", "Baz"},
+		{"_foo", "_bar", "_bar"},
+		{"_Foo", "_bar", "_Bar"},
+		{"żółw", "ŁOŚ", "łoś"},
+		{"Żółw", "łoś", "Łoś"},
+		{"ŻÓŁW", "łoś", "ŁOŚ"},
+		{"Foo", "", ""},
+		{"Foo", "BAR", "Bar"},
+		{"Foo", "bAR2 baz", "Bar2 baz"},
+		{"Foo", "BAR BAZ", "Bar BAZ"},
+	}
+
+	for i, tc := range tests {
+		out := matchCase(tc.match, tc.s)
+		if out != tc.out {
+			t.Errorf("#%d: matchCase(%q, %q) = %q, oczekiwano: %q",
+				i, tc.match, tc.s, out, tc.out)
+		}
+	}
+}
+
+func TestKeepCase(t *testing.T) {
+	defer func() {
+		keepCase = false
+	}()
+
+	keepCase = true
+	r, err := newRule("[fF][oO][oO]", "bar&")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := subline("foo Foo FOO fOo", r.pat, r.sub)
+	if err != nil {
+		t.Error(err)
+	}
+	exp := "barfoo Barfoo BARFOO barfOo"
+	if out != exp {
+		t.Errorf("oczekiwano: %q, jest: %q", exp, out)
+	}
+
+	// wzorzec małymi literami pasuje do tekstu o dowolnej wielkości liter
+	r, err = newRule("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = subline("Foo foo FOO fOO", r.pat, r.sub)
+	if err != nil {
+		t.Error(err)
+	}
+	exp = "Bar bar BAR bar"
+	if out != exp {
+		t.Errorf("oczekiwano: %q, jest: %q", exp, out)
+	}
+}
+
+func TestSubtextMode(t *testing.T) {
+	defer func() {
+		mode = modeLine
+	}()
+
+	tests := []struct {
+		mode int
+		text string
+		pat  string
+		sub  string
+		out  string
+	}{
+		{modeLine, "a\nb\n", "@n", " ", "a\nb\n"},
+		{modeWhole, "a\nb\nc\n", "@n", " ", "a b c\n"},
+		{modeWhole, "a\nb", "@n", " ", "a b"},
+		{modeWhole, "ab\ncb\n", "b$", "X", "aX\ncX\n"},
+		{modeWhole, "ax\nbx", "x$", "Y", "aY\nbY"},
+		{modePara, "ax\nbx\n\ncx\n", "x$", "Y", "aY\nbY\n\ncY\n"},
+		{modeWhole, "ab\ncd\n", "?$", "<&>", "a<b>\nc<d>\n"},
+		{modeWhole, "ab\ncd\n", "%?", "<&>", "<a>b\n<c>d\n"},
+		{
+			modePara,
+			"\n\na\nb\n\n\nc\nd\n",
+			"@n", " ",
+			"\n\na b\n\n\nc d\n",
+		},
+		{modePara, "a\nb", "@n", " ", "a b"},
+		{modePara, "a\n\nb\n", "a@n@nb", "X", "a\n\nb\n"},
+	}
+
+	for i, tc := range tests {
+		mode = tc.mode
+		r, err := newRule(tc.pat, tc.sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := subtext(tc.text, []rule{r})
+		if err != nil {
+			t.Error(err)
+		}
+		if out != tc.out {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, tc.out, out)
+		}
+	}
+
+	// czytanie całego wejścia przez change
+	mode = modeWhole
+	r, err := newRule("-@n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := new(bytes.Buffer)
+	err = change(w, strings.NewReader("roz-\ndzielony\n"), []rule{r})
+	if err != nil {
+		t.Error(err)
+	}
+	if w.String() != "rozdzielony\n" {
+		t.Errorf("oczekiwano: %q, jest: %q", "rozdzielony\n", w.String())
+	}
+}
@@ -0,0 +1,161 @@
+// Plik zawiera funkcjonalność związaną z regułami zamiany wczytywanymi
+// z pliku (opcja -f).
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/adbr/npwp/5/pattern"
+)
+
+// Znak rozpoczynający wiersz komentarza w pliku reguł.
+const s_comment = '#'
+
+// Znak wyróżnika (escape) we wzorcu i tekście zastępującym.
+const s_esc = '@'
+
+// Typ rule zawiera regułę zamiany: skompilowany wzorzec i tekst
+// zastępujący w postaci zwracanej przez getsub.
+type rule struct {
+	pat pattern.Pattern
+	sub string
+}
+
+// newRule kompiluje wzorzec pat i tekst zastępujący sub do postaci
+// reguły zamiany. W trybie wielowierszowym (mode różne od modeLine)
+// wzorzec jest przystosowywany do bloków zawierających wiele wierszy
+// (patrz pattern.Multiline), a przy opcji keepCase - do dopasowywania
+// bez względu na wielkość liter (patrz pattern.Fold).
+func newRule(pat, sub string) (rule, error) {
+	p, err := pattern.Makepat(pat)
+	if err != nil {
+		return rule{}, err
+	}
+	if mode != modeLine {
+		p = pattern.Multiline(p)
+	}
+	if keepCase {
+		p, err = pattern.Fold(p)
+		if err != nil {
+			return rule{}, err
+		}
+	}
+	s, err := getsub(sub)
+	if err != nil {
+		return rule{}, err
+	}
+	return rule{p, s}, nil
+}
+
+// sublines zamienia w wierszu line fragmenty pasujące do wzorców reguł
+// rules. Reguły są stosowane kolejno, każda do wyniku poprzedniej.
+// Jeśli podano wzorzec address, to zmieniane są tylko wiersze (bloki)
+// do niego pasujące; wiersz jest dopasowywany razem ze znakiem '\n'
+// (jak w programie find), więc we wzorcu address można użyć '$'.
+func sublines(line string, rules []rule) (string, error) {
+	if hasAddress && !pattern.Match(line+"\n", address) {
+		return line, nil
+	}
+	for _, r := range rules {
+		var err error
+		line, err = subline(line, r.pat, r.sub)
+		if err != nil {
+			return line, err
+		}
+	}
+	return line, nil
+}
+
+// readRules czyta reguły zamiany z pliku fname.
+func readRules(fname string) ([]rule, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseRules(f, fname)
+}
+
+// parseRules czyta reguły zamiany z r, po jednej w wierszu. Wiersze
+// puste i zaczynające się od znaku '#' są pomijane. Reguła ma postać
+// /pattern/substitution/, gdzie zamiast '/' może być użyty dowolny
+// znak (ogranicznik) nie będący literą, cyfrą, odstępem ani znakiem
+// '@'; ostatni ogranicznik może być pominięty. Ogranicznik wewnątrz
+// wzorca lub tekstu zastępującego należy poprzedzić znakiem '@'.
+// Błędy zawierają nazwę pliku name i numer wiersza.
+func parseRules(r io.Reader, name string) ([]rule, error) {
+	var rules []rule
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimLeft(scanner.Text(), " \t")
+		if line == "" || line[0] == s_comment {
+			continue
+		}
+		pat, sub, err := splitRule(line)
+		if err == nil {
+			var r rule
+			r, err = newRule(pat, sub)
+			rules = append(rules, r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, lineno, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// splitRule dzieli regułę s postaci /pattern/substitution/ na wzorzec
+// i tekst zastępujący, w postaci źródłowej.
+func splitRule(s string) (pat, sub string, err error) {
+	d, n := utf8.DecodeRuneInString(s)
+	if d == utf8.RuneError || d == s_esc ||
+		unicode.IsLetter(d) || unicode.IsDigit(d) || unicode.IsSpace(d) {
+		return "", "", fmt.Errorf("zły ogranicznik reguły: %q", d)
+	}
+	s = s[n:]
+
+	pat, s, ok := cutDelim(s, d)
+	if !ok {
+		return "", "", fmt.Errorf("brak ogranicznika %q po wzorcu", d)
+	}
+	if pat == "" {
+		return "", "", errors.New("pusty wzorzec")
+	}
+	sub, s, _ = cutDelim(s, d)
+	if s != "" {
+		return "", "", fmt.Errorf("nadmiarowe znaki po regule: %q", s)
+	}
+	return pat, sub, nil
+}
+
+// cutDelim dzieli s w miejscu pierwszego ogranicznika d nie
+// poprzedzonego znakiem '@'. Zwraca tekst przed i po ograniczniku
+// oraz true gdy ogranicznik został znaleziony. Jeśli ogranicznika nie
+// ma, to zwraca s, pusty string i false.
+func cutDelim(s string, d rune) (before, after string, ok bool) {
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if r == s_esc {
+			i += n
+			_, n = utf8.DecodeRuneInString(s[i:])
+			i += n
+			continue
+		}
+		if r == d {
+			return s[:i], s[i+n:], true
+		}
+		i += n
+	}
+	return s, "", false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitRule(t *testing.T) {
+	tests := []struct {
+		s   string
+		pat string
+		sub string
+		e   bool // czy powinien wystąpić błąd
+	}{
+		{"/a/b/", "a", "b", false},
+		{"/a/b", "a", "b", false},
+		{"/a/", "a", "", false},
+		{"/a//", "a", "", false},
+		{"|ą|a|", "ą", "a", false},
+		{"/a@/b/c/", "a@/b", "c", false},
+		{"/[@/x]*/&@&/", "[@/x]*", "&@&", false},
+		{"/a", "", "", true},
+		{"//b/", "", "", true},
+		{"/a/b/c", "", "", true},
+		{"xaxbx", "", "", true},
+		{"@a@b@", "", "", true},
+	}
+
+	for i, tc := range tests {
+		pat, sub, err := splitRule(tc.s)
+		if tc.e {
+			if err == nil {
+				t.Errorf("#%d: powinien wystąpić błąd", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+		if pat != tc.pat || sub != tc.sub {
+			t.Errorf("#%d: oczekiwano: %q, %q, jest: %q, %q",
+				i, tc.pat, tc.sub, pat, sub)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	in := `# zamiana polskich znaków
+/ą/a/
+
+  /ę/e/
+|a|A|
+`
+	rules, err := parseRules(strings.NewReader(in), "r.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("oczekiwano 3 reguł, jest: %d", len(rules))
+	}
+
+	// reguły są stosowane kolejno
+	out, err := sublines("gęś ąę", rules)
+	if err != nil {
+		t.Error(err)
+	}
+	if out != "geś Ae" {
+		t.Errorf("oczekiwano: %q, jest: %q", "geś Ae", out)
+	}
+
+	// błąd zawiera numer wiersza
+	in = "/a/b/\n# komentarz\n/[a/x/\n"
+	_, err = parseRules(strings.NewReader(in), "r.txt")
+	if err == nil {
+		t.Fatal("powinien wystąpić błąd")
+	}
+	if !strings.HasPrefix(err.Error(), "r.txt:3: ") {
+		t.Errorf("zły komunikat błędu: %q", err)
+	}
+}
@@ -9,12 +9,67 @@ find - wyszukuje wiersze tekstu pasujące do wzorca
 
 SPOSÓB UŻYCIA
 
-find wzorzec [<file] [>file2]
+find [-r] [-L] [-n] [-A n] [-B n] [-C n] [-j n] [-include glob] [-exclude glob]
+	[-color kiedy] [-json] wzorzec [plik ...]
 
 OPIS
 
-Program find czyta wiersze tekstu z stdin i drukuje na stdout te
-wiersze, które zawierają fragment pasujący do wzorca.
+Program find czyta wiersze tekstu z podanych plików lub z stdin (gdy
+nie podano plików) i drukuje na stdout te wiersze, które zawierają
+fragment pasujący do wzorca. Jeśli przeszukiwany jest więcej niż
+jeden plik, to każdy wiersz jest poprzedzony nazwą pliku i znakiem
+':'.
+
+Opcje:
+
+	-n		poprzedza wiersze ich numerem w pliku
+	-A n		drukuje n wierszy kontekstu po wierszu pasującym
+	-B n		drukuje n wierszy kontekstu przed wierszem pasującym
+	-C n		drukuje n wierszy kontekstu przed i po wierszu
+			pasującym (opcje -A i -B mają pierwszeństwo, także
+			z wartością 0)
+	-r		przeszukuje rekurencyjnie drzewa katalogów podanych
+			jako argumenty (domyślnie katalog bieżący)
+	-L		podąża za dowiązaniami symbolicznymi napotkanymi
+			podczas przeszukiwania katalogów (dowiązania podane
+			jako argumenty są zawsze rozwijane)
+	-j n		przeszukuje równolegle n plików (domyślnie liczba
+			procesorów); wyniki są drukowane w kolejności
+			plików, bez przemieszania wierszy różnych plików
+	-include glob	przeszukuje tylko pliki, których nazwa pasuje do
+			wzorca glob (np. '*.go'); opcja może być powtórzona
+	-exclude glob	pomija pliki, których nazwa pasuje do wzorca glob;
+			opcja może być powtórzona
+	-color kiedy	wyróżnia kolorem (sekwencjami ANSI) fragmenty
+			wierszy pasujące do wzorca; kiedy może mieć wartość
+			auto (domyślnie, gdy stdout jest terminalem),
+			always lub never
+	-json		zamiast wierszy drukuje opisy dopasowań w formacie
+			JSON, po jednym obiekcie w wierszu (opis poniżej)
+
+Nazwa pliku i numer wiersza są zakończone znakiem ':' w wierszach
+pasujących do wzorca i znakiem '-' w wierszach kontekstu. Nakładające
+się grupy wierszy kontekstu są łączone, a grupy nie sąsiadujące ze
+sobą są oddzielone wierszem "--".
+
+W formacie JSON (opcja -json) każdy fragment wiersza pasujący do
+wzorca jest opisany obiektem:
+
+	{"file":"a.go","line":12,"offset":345,"text":"Makepat"}
+
+gdzie file jest nazwą pliku ("-" dla stdin), line numerem wiersza,
+offset indeksem pierwszego bajtu dopasowania w pliku, a text
+dopasowanym tekstem. Opcje kontekstu i -color są wtedy pomijane.
+
+Zamiast pojedynczego znaku '-' przed nazwą opcji można użyć '--',
+np. --include='*.go'. Wzorce glob mają składnię jak w funkcji
+filepath.Match i są dopasowywane do nazwy pliku bez katalogu.
+
+Pliki binarne są pomijane. Plik jest uznawany za binarny, jeśli jego
+początkowy blok zawiera bajt NUL lub niepoprawne kodowanie utf8. O
+pominięciu pliku binarnego podanego w wierszu poleceń (a nie
+znalezionego w katalogu przy opcji -r) jest drukowana informacja na
+stderr: "find: plik: plik binarny pominięty".
 
 Wzorzec jest konkatenacją następujących elementów:
 
@@ -63,5 +118,9 @@ Wydrukowanie wierszy zawierających komentarz zaczynający się od początku wie
 
 	cat *.go | ./find "%//?*"
 
+Wyszukanie wywołań funkcji Makepat w plikach *.go w drzewie katalogów:
+
+	find -r -include '*.go' Makepat( .
+
 */
 package main
@@ -4,22 +4,148 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/adbr/npwp/5/pattern"
 )
 
+// Rozmiar początkowego bloku pliku, na podstawie którego rozpoznaje
+// się pliki binarne.
+const blksize = 4096
+
+// Typ globList jest listą wzorców nazw plików podawanych w wielokrotnie
+// powtarzanej opcji. Implementuje interfejs flag.Value.
+type globList []string
+
+func (g *globList) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globList) Set(s string) error {
+	if _, err := filepath.Match(s, ""); err != nil {
+		return fmt.Errorf("zły wzorzec nazwy pliku %q: %s", s, err)
+	}
+	*g = append(*g, s)
+	return nil
+}
+
+var (
+	recursive bool     // czy przeszukiwać katalogi rekurencyjnie
+	follow    bool     // czy podążać za dowiązaniami symbolicznymi
+	includes  globList // wzorce nazw plików, które należy przeszukać
+	excludes  globList // wzorce nazw plików, które należy pominąć
+	njobs     int      // liczba równolegle przeszukiwanych plików
+	number    bool     // czy drukować numery wierszy
+	after     int      // liczba wierszy kontekstu po dopasowaniu
+	before    int      // liczba wierszy kontekstu przed dopasowaniem
+	color     bool     // czy wyróżniać dopasowane fragmenty kolorem
+	jsonOut   bool     // czy drukować dopasowania w formacie JSON
+)
+
+// Nazwy plików podanych w wierszu poleceń (a nie znalezionych w
+// katalogach). O pominięciu takiego pliku binarnego jest drukowana
+// informacja na stderr.
+var named = make(map[string]bool)
+
+// errBinary jest zwracany przez findFile dla pominiętych plików
+// binarnych.
+var errBinary = errors.New("plik binarny pominięty")
+
+// Separator grup wierszy kontekstu.
+const groupsep = "--\n"
+
+// Sekwencje ANSI rozpoczynające i kończące wyróżnienie kolorem.
+const (
+	colorStart = "\x1b[01;31m"
+	colorEnd   = "\x1b[m"
+)
+
+// Typ jsonMatch opisuje jedno dopasowanie drukowane w formacie JSON.
+type jsonMatch struct {
+	File   string `json:"file"`   // nazwa pliku
+	Line   int    `json:"line"`   // numer wiersza
+	Offset int64  `json:"offset"` // indeks bajtu początku dopasowania w pliku
+	Text   string `json:"text"`   // dopasowany tekst
+}
+
+const usageStr = "usage: find [-r] [-L] [-n] [-A N] [-B N] [-C N] [-j N] [-include GLOB] [-exclude GLOB] [-color WHEN] [-json] PATTERN [file ...]"
+
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: find PATTERN")
+	fmt.Fprintln(os.Stderr, usageStr)
 	os.Exit(1)
 }
 
-func find(w io.Writer, r io.Reader, pat pattern.Pattern) error {
+// Typ ring jest buforem cyklicznym przechowującym ostatnie wiersze
+// tekstu razem z ich numerami.
+type ring struct {
+	lines []string // wiersze
+	nums  []int    // numery wierszy
+	start int      // indeks najstarszego wiersza
+	n     int      // liczba wierszy w buforze
+}
+
+func newRing(size int) *ring {
+	return &ring{
+		lines: make([]string, size),
+		nums:  make([]int, size),
+	}
+}
+
+// push dodaje wiersz lin o numerze num do bufora. Gdy bufor jest
+// pełny, to najstarszy wiersz jest usuwany.
+func (r *ring) push(lin string, num int) {
+	if len(r.lines) == 0 {
+		return
+	}
+	i := (r.start + r.n) % len(r.lines)
+	r.lines[i] = lin
+	r.nums[i] = num
+	if r.n < len(r.lines) {
+		r.n++
+	} else {
+		r.start = (r.start + 1) % len(r.lines)
+	}
+}
+
+// pop usuwa i zwraca najstarszy wiersz z bufora. Bufor nie może być
+// pusty.
+func (r *ring) pop() (string, int) {
+	lin, num := r.lines[r.start], r.nums[r.start]
+	r.start = (r.start + 1) % len(r.lines)
+	r.n--
+	return lin, num
+}
+
+// find drukuje do w wiersze z r pasujące do wzorca pat. Jeśli name
+// nie jest pusty, to każdy wiersz jest poprzedzony nazwą pliku name.
+// Jeśli ustawiona jest opcja number, to wiersze są poprzedzone
+// numerem. Nazwa i numer są zakończone znakiem ':' dla wierszy
+// pasujących i znakiem '-' dla wierszy kontekstu. Wiersze kontekstu
+// (before wierszy przed i after wierszy po wierszu pasującym) są
+// łączone w grupy, a grupy nie sąsiadujące ze sobą są oddzielone
+// wierszem "--". Jeśli ustawiona jest opcja jsonOut, to zamiast
+// wierszy drukowane są opisy dopasowań w formacie JSON, a opcje
+// kontekstu nie są używane.
+func find(w io.Writer, r io.Reader, pat pattern.Pattern, name string) error {
 	br := bufio.NewReader(r)
-	for done := false; !done; {
+	enc := json.NewEncoder(w)
+	prev := newRing(before) // wiersze przed dopasowaniem
+	last := 0               // numer ostatnio wydrukowanego wiersza
+	left := 0               // liczba wierszy kontekstu do wydrukowania
+	off := int64(0)         // indeks początku wiersza w pliku
+	for num, done := 1, false; !done; num++ {
 		lin, err := br.ReadString('\n')
 		if err != nil && err != io.EOF {
 			return err
@@ -32,25 +158,424 @@ func find(w io.Writer, r io.Reader, pat pattern.Pattern) error {
 				return nil
 			}
 		}
+		if jsonOut {
+			for _, sp := range spans(lin, pat) {
+				err := enc.Encode(jsonMatch{
+					File:   name,
+					Line:   num,
+					Offset: off + int64(sp[0]),
+					Text:   lin[sp[0]:sp[1]],
+				})
+				if err != nil {
+					return err
+				}
+			}
+			off += int64(len(lin))
+			continue
+		}
 		if pattern.Match(lin, pat) {
-			io.WriteString(w, lin)
+			first := num - prev.n // numer pierwszego wiersza grupy
+			if last > 0 && first > last+1 && (before > 0 || after > 0) {
+				io.WriteString(w, groupsep)
+			}
+			for prev.n > 0 {
+				l, n := prev.pop()
+				putline(w, name, n, '-', l)
+			}
+			if color {
+				lin = highlight(lin, spans(lin, pat))
+			}
+			putline(w, name, num, ':', lin)
+			last = num
+			left = after
+		} else if left > 0 {
+			putline(w, name, num, '-', lin)
+			last = num
+			left--
+		} else {
+			prev.push(lin, num)
 		}
 	}
 	return nil
 }
 
+// putline drukuje do w wiersz lin o numerze num poprzedzony nazwą
+// pliku name (jeśli nie jest pusta) i numerem (jeśli ustawiona jest
+// opcja number). Po nazwie i numerze drukowany jest znak sep.
+func putline(w io.Writer, name string, num int, sep byte, lin string) {
+	if name != "" {
+		io.WriteString(w, name+string(sep))
+	}
+	if number {
+		fmt.Fprintf(w, "%d%c", num, sep)
+	}
+	io.WriteString(w, lin)
+}
+
+// spans zwraca indeksy początków i końców kolejnych, nie nakładających
+// się fragmentów wiersza lin pasujących do wzorca pat. Fragmenty o
+// zerowej długości (np. dla wzorca "%") są zwracane tylko wtedy, gdy
+// w wierszu nie ma żadnego niepustego fragmentu pasującego.
+func spans(lin string, pat pattern.Pattern) [][2]int {
+	var sp [][2]int
+	empty := -1 // indeks pierwszego pustego dopasowania
+	for i := 0; i < len(lin); {
+		j, n := pattern.Index(lin, i, pat)
+		if j < 0 {
+			break
+		}
+		if n > 0 {
+			sp = append(sp, [2]int{j, j + n})
+			i = j + n
+			continue
+		}
+		if empty < 0 {
+			empty = j
+		}
+		_, rn := utf8.DecodeRuneInString(lin[j:])
+		i = j + rn
+	}
+	if len(sp) == 0 && empty >= 0 {
+		sp = append(sp, [2]int{empty, empty})
+	}
+	return sp
+}
+
+// highlight zwraca wiersz lin, w którym fragmenty sp są otoczone
+// sekwencjami ANSI wyróżniającymi je kolorem.
+func highlight(lin string, sp [][2]int) string {
+	var b strings.Builder
+	i := 0
+	for _, s := range sp {
+		if s[0] == s[1] {
+			continue
+		}
+		b.WriteString(lin[i:s[0]])
+		b.WriteString(colorStart)
+		b.WriteString(lin[s[0]:s[1]])
+		b.WriteString(colorEnd)
+		i = s[1]
+	}
+	b.WriteString(lin[i:])
+	return b.String()
+}
+
+// findFile przeszukuje plik fname. Pliki binarne są pomijane - wtedy
+// zwracany jest błąd errBinary. Jeśli
+// prefix ma wartość true, to wiersze są poprzedzone nazwą pliku. W
+// formacie JSON nazwa pliku jest drukowana zawsze.
+func findFile(w io.Writer, fname string, pat pattern.Pattern, prefix bool) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, blksize)
+	blk, err := br.Peek(blksize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	if isBinary(blk) {
+		return errBinary
+	}
+
+	name := ""
+	if prefix || jsonOut {
+		name = fname
+	}
+	return find(w, br, pat, name)
+}
+
+// Typ result zawiera wynik przeszukiwania jednego pliku.
+type result struct {
+	out []byte // wiersze pasujące do wzorca
+	err error  // błąd przeszukiwania
+}
+
+// findAll przeszukuje pliki files równolegle przy użyciu njobs
+// gorutyn i drukuje wyniki do w w kolejności plików w files. Wynik
+// każdego pliku jest zbierany w buforze i drukowany w całości, więc
+// wiersze z różnych plików nie są przemieszane. Liczba plików
+// przeszukanych i jeszcze nie wydrukowanych jest ograniczona, żeby
+// wolny plik nie powodował gromadzenia w pamięci wyników wszystkich
+// następnych plików. Błędy są drukowane na stderr; zwraca liczbę
+// błędów. Pominięcie pliku binarnego nie jest błędem, a informacja o
+// nim jest drukowana tylko dla plików z named.
+func findAll(w io.Writer, files []string, pat pattern.Pattern, prefix bool, njobs int) int {
+	if njobs < 1 {
+		njobs = 1
+	}
+
+	results := make([]chan result, len(files))
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+
+	jobs := make(chan int)
+	window := make(chan bool, 4*njobs) // ogranicza liczbę wyników w pamięci
+	go func() {
+		for i := range files {
+			window <- true
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	for n := 0; n < njobs; n++ {
+		go func() {
+			for i := range jobs {
+				var buf bytes.Buffer
+				err := findFile(&buf, files[i], pat, prefix)
+				results[i] <- result{buf.Bytes(), err}
+			}
+		}()
+	}
+
+	nerr := 0
+	printed := false // czy wydrukowano już wynik jakiegoś pliku
+	for i := range files {
+		res := <-results[i]
+		if len(res.out) > 0 && printed && (before > 0 || after > 0) {
+			io.WriteString(w, groupsep)
+		}
+		if len(res.out) > 0 {
+			printed = true
+		}
+		w.Write(res.out)
+		if res.err == errBinary {
+			if named[files[i]] {
+				fmt.Fprintf(os.Stderr, "find: %s: %s\n", files[i], res.err)
+			}
+		} else if res.err != nil {
+			fmt.Fprintf(os.Stderr, "find: %s\n", res.err)
+			nerr++
+		}
+		<-window
+	}
+	return nerr
+}
+
+// isBinary sprawdza czy początkowy blok pliku blk pochodzi z pliku
+// binarnego, czyli czy zawiera bajt NUL lub niepoprawne kodowanie
+// utf8. Niepełny znak utf8 na końcu bloku nie jest traktowany jako
+// błąd kodowania.
+func isBinary(blk []byte) bool {
+	if bytes.IndexByte(blk, 0) >= 0 {
+		return true
+	}
+
+	// odetnij niepełny znak na końcu bloku
+	for i := len(blk) - 1; i >= 0 && i >= len(blk)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(blk[i]) {
+			if !utf8.FullRune(blk[i:]) {
+				blk = blk[:i]
+			}
+			break
+		}
+	}
+
+	return !utf8.Valid(blk)
+}
+
+// selected sprawdza czy plik o nazwie name (bez katalogu) pasuje do
+// wzorców includes i nie pasuje do wzorców excludes. Pusta lista
+// includes oznacza wszystkie pliki.
+func selected(name string) bool {
+	ok := len(includes) == 0
+	for _, g := range includes {
+		if m, _ := filepath.Match(g, name); m {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return false
+	}
+	for _, g := range excludes {
+		if m, _ := filepath.Match(g, name); m {
+			return false
+		}
+	}
+	return true
+}
+
+// walk zwraca nazwy plików zwykłych z drzewa katalogów root, wybranych
+// zgodnie z wzorcami includes i excludes. Dowiązania symboliczne są
+// pomijane, chyba że root jest dowiązaniem lub ustawiona jest opcja
+// follow. Katalogi odwiedzone wcześniej (seen) nie są przeszukiwane
+// ponownie, co chroni przed pętlami dowiązań. Błędy dostępu do plików
+// są zgłaszane na stderr i nie przerywają przeszukiwania; zwraca
+// liczbę błędów.
+func walk(root string, seen *[]os.FileInfo) ([]string, int) {
+	var files []string
+	nerr := 0
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "find: %s\n", err)
+			nerr++
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			if !follow && path != root {
+				return nil
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "find: %s\n", err)
+				nerr++
+				return nil
+			}
+			if fi.IsDir() {
+				// końcowy separator powoduje, że WalkDir przechodzi
+				// do katalogu wskazywanego przez dowiązanie
+				f, n := walk(path+string(filepath.Separator), seen)
+				files = append(files, f...)
+				nerr += n
+				return nil
+			}
+			if fi.Mode().IsRegular() && selected(d.Name()) {
+				files = append(files, path)
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			fi, err := d.Info()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "find: %s\n", err)
+				nerr++
+				return fs.SkipDir
+			}
+			for _, s := range *seen {
+				if os.SameFile(fi, s) {
+					return fs.SkipDir
+				}
+			}
+			*seen = append(*seen, fi)
+			return nil
+		}
+
+		if d.Type().IsRegular() && selected(d.Name()) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, nerr
+}
+
+// setContext ustawia liczby wierszy kontekstu after i before na
+// wartość context opcji -C, jeśli opcja -C została podana. Opcje -A i
+// -B mają pierwszeństwo przed -C, także z wartością 0. Mapa set
+// zawiera nazwy podanych opcji.
+func setContext(context int, set map[string]bool) {
+	if !set["C"] {
+		return
+	}
+	if !set["A"] {
+		after = context
+	}
+	if !set["B"] {
+		before = context
+	}
+}
+
 func main() {
-	if len(os.Args) < 2 {
+	log.SetPrefix("find: ")
+	log.SetFlags(0)
+
+	flag.BoolVar(&recursive, "r", false, "przeszukuje katalogi rekurencyjnie")
+	flag.BoolVar(&follow, "L", false, "podąża za dowiązaniami symbolicznymi")
+	flag.BoolVar(&number, "n", false, "drukuje numery wierszy")
+	flag.IntVar(&after, "A", 0, "drukuje N wierszy kontekstu po wierszu pasującym")
+	flag.IntVar(&before, "B", 0, "drukuje N wierszy kontekstu przed wierszem pasującym")
+	context := flag.Int("C", 0, "drukuje N wierszy kontekstu przed i po wierszu pasującym")
+	flag.IntVar(&njobs, "j", runtime.NumCPU(), "liczba równolegle przeszukiwanych plików")
+	flag.Var(&includes, "include", "przeszukuje tylko pliki pasujące do wzorca")
+	flag.Var(&excludes, "exclude", "pomija pliki pasujące do wzorca")
+	when := flag.String("color", "auto", "wyróżnia dopasowania kolorem: auto, always lub never")
+	flag.BoolVar(&jsonOut, "json", false, "drukuje dopasowania w formacie JSON")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		usage()
 	}
+	if after < 0 || before < 0 || *context < 0 {
+		log.Fatal("ujemna liczba wierszy kontekstu")
+	}
+	set := make(map[string]bool) // opcje podane w wierszu poleceń
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	setContext(*context, set)
+	if jsonOut {
+		after = 0
+		before = 0
+	}
+
+	switch *when {
+	case "always":
+		color = true
+	case "never":
+		color = false
+	case "auto":
+		fi, err := os.Stdout.Stat()
+		color = err == nil && fi.Mode()&os.ModeCharDevice != 0
+	default:
+		log.Fatalf("zła wartość opcji -color: %q", *when)
+	}
+	if jsonOut {
+		color = false
+	}
 
-	pat, err := pattern.Makepat(os.Args[1])
+	pat, err := pattern.Makepat(flag.Arg(0))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = find(os.Stdout, os.Stdin, pat)
+	args := flag.Args()[1:]
+	if len(args) == 0 && !recursive {
+		name := ""
+		if jsonOut {
+			name = "-"
+		}
+		err = find(os.Stdout, os.Stdin, pat, name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	for _, a := range args {
+		named[a] = true
+	}
+
+	var files []string
+	nerr := 0 // liczba błędów przeszukiwania katalogów i plików
+	if recursive {
+		var seen []os.FileInfo
+		for _, a := range args {
+			f, n := walk(a, &seen)
+			files = append(files, f...)
+			nerr += n
+		}
+	} else {
+		files = args
+	}
+
+	prefix := recursive || len(files) > 1
+	w := bufio.NewWriter(os.Stdout)
+	nerr += findAll(w, files, pat, prefix, njobs)
+	err = w.Flush()
 	if err != nil {
 		log.Fatal(err)
 	}
+	if nerr > 0 {
+		os.Exit(2)
+	}
 }
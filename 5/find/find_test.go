@@ -4,7 +4,14 @@ package main
 
 import (
 	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/adbr/npwp/5/pattern"
 )
 
 // Testowanie czytania i zapisywania wierszy.
@@ -41,11 +48,11 @@ func TestFind(t *testing.T) {
 		},
 	}
 
-	pat := pattern("")
+	pat := pattern.Pattern("")
 	for i, tc := range tests {
 		w := new(bytes.Buffer)
 		r := bytes.NewBufferString(tc.in)
-		err := find(w, r, pat)
+		err := find(w, r, pat, "")
 		if err != nil {
 			t.Error(err)
 		}
@@ -55,3 +62,395 @@ func TestFind(t *testing.T) {
 		}
 	}
 }
+
+func TestFindName(t *testing.T) {
+	pat, err := pattern.Makepat("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := new(bytes.Buffer)
+	r := bytes.NewBufferString("aaa\nbbb\nccc\nabc")
+	err = find(w, r, pat, "x.txt")
+	if err != nil {
+		t.Error(err)
+	}
+	exp := "x.txt:bbb\nx.txt:abc"
+	if w.String() != exp {
+		t.Errorf("oczekiwano: %q, jest: %q", exp, w.String())
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		blk string
+		bin bool
+	}{
+		{"", false},
+		{"abc\n", false},
+		{"zażółć gęślą jaźń\n", false},
+		{"abc\x00def", true},
+		{"abc\xffdef", true},
+		// niepełny znak 'ą' na końcu bloku
+		{"abc\xc4", false},
+		// niepełny znak w środku bloku
+		{"a\xc4bc", true},
+	}
+
+	for i, tc := range tests {
+		bin := isBinary([]byte(tc.blk))
+		if bin != tc.bin {
+			t.Errorf("#%d: isBinary(%q) = %v, oczekiwano: %v",
+				i, tc.blk, bin, tc.bin)
+		}
+	}
+}
+
+func TestSelected(t *testing.T) {
+	defer func() {
+		includes = nil
+		excludes = nil
+	}()
+
+	tests := []struct {
+		inc  globList
+		exc  globList
+		name string
+		ok   bool
+	}{
+		{nil, nil, "a.go", true},
+		{globList{"*.go"}, nil, "a.go", true},
+		{globList{"*.go"}, nil, "a.txt", false},
+		{globList{"*.txt", "*.go"}, nil, "a.go", true},
+		{nil, globList{"*_test.go"}, "a.go", true},
+		{nil, globList{"*_test.go"}, "a_test.go", false},
+		{globList{"*.go"}, globList{"*_test.go"}, "a_test.go", false},
+	}
+
+	for i, tc := range tests {
+		includes = tc.inc
+		excludes = tc.exc
+		ok := selected(tc.name)
+		if ok != tc.ok {
+			t.Errorf("#%d: selected(%q) = %v, oczekiwano: %v",
+				i, tc.name, ok, tc.ok)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	defer func() {
+		includes = nil
+		follow = false
+	}()
+
+	dir := t.TempDir()
+	files := []string{
+		"a.go",
+		"b.txt",
+		"d/c.go",
+		"d/e/f.go",
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte("abc\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// dowiązanie tworzące pętlę
+	err := os.Symlink(dir, filepath.Join(dir, "d", "loop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	includes = globList{"*.go"}
+	exp := []string{
+		filepath.Join(dir, "a.go"),
+		filepath.Join(dir, "d/c.go"),
+		filepath.Join(dir, "d/e/f.go"),
+	}
+
+	var seen []os.FileInfo
+	got, nerr := walk(dir, &seen)
+	if !reflect.DeepEqual(got, exp) || nerr != 0 {
+		t.Errorf("oczekiwano: %q, jest: %q (błędy: %d)", exp, got, nerr)
+	}
+
+	// z podążaniem za dowiązaniami pętla jest wykrywana
+	follow = true
+	seen = nil
+	got, nerr = walk(dir, &seen)
+	if !reflect.DeepEqual(got, exp) || nerr != 0 {
+		t.Errorf("follow: oczekiwano: %q, jest: %q (błędy: %d)", exp, got, nerr)
+	}
+
+	// błędy są liczone: nieistniejący katalog i dowiązanie do
+	// nieistniejącego pliku
+	err = os.Symlink(filepath.Join(dir, "none"), filepath.Join(dir, "d", "bad.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen = nil
+	_, nerr = walk(filepath.Join(dir, "none"), &seen)
+	if nerr != 1 {
+		t.Errorf("nieistniejący katalog: oczekiwano 1 błędu, jest: %d", nerr)
+	}
+	seen = nil
+	got, nerr = walk(dir, &seen)
+	if !reflect.DeepEqual(got, exp) || nerr != 1 {
+		t.Errorf("dowiązanie: oczekiwano: %q, jest: %q (błędy: %d)", exp, got, nerr)
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	var exp string
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("f%02d.txt", i))
+		var data string
+		for j := 0; j < 100; j++ {
+			data += fmt.Sprintf("%d abc %d\n", i, j)
+			if j%10 == 0 {
+				exp += fmt.Sprintf("%s:%d abc %d\n", name, i, j)
+			}
+		}
+		err := os.WriteFile(name, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, name)
+	}
+
+	pat, err := pattern.Makepat("abc ?*0$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, 3, 16} {
+		w := new(bytes.Buffer)
+		nerr := findAll(w, files, pat, true, n)
+		if nerr != 0 {
+			t.Errorf("njobs %d: liczba błędów: %d", n, nerr)
+		}
+		if w.String() != exp {
+			t.Errorf("njobs %d: zła kolejność lub zawartość wyniku", n)
+		}
+	}
+}
+
+func TestFindBinary(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	txt := filepath.Join(dir, "txt")
+	err := os.WriteFile(bin, []byte("abc\x00abc\n"), 0644)
+	if err == nil {
+		err = os.WriteFile(txt, []byte("abc\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pat, err := pattern.Makepat("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := new(bytes.Buffer)
+	err = findFile(w, bin, pat, false)
+	if err != errBinary || w.Len() != 0 {
+		t.Errorf("plik binarny: oczekiwano: %v, jest: %v, %q", errBinary, err, w)
+	}
+
+	// pominięcie pliku binarnego nie jest błędem
+	nerr := findAll(w, []string{bin, txt}, pat, false, 1)
+	if nerr != 0 || w.String() != "abc\n" {
+		t.Errorf("oczekiwano: %q, jest: %q (błędy: %d)", "abc\n", w, nerr)
+	}
+}
+
+func TestFindContext(t *testing.T) {
+	defer func() {
+		number = false
+		before = 0
+		after = 0
+	}()
+
+	in := "1\n2 x\n3\n4\n5\n6\n7 x\n8\n9 x\n10\n11\n12\n"
+	tests := []struct {
+		before int
+		after  int
+		number bool
+		out    string
+	}{
+		{
+			0, 0, true,
+			"2:2 x\n7:7 x\n9:9 x\n",
+		},
+		{
+			// grupy oddzielone separatorem
+			0, 1, false,
+			"2 x\n3\n--\n7 x\n8\n9 x\n10\n",
+		},
+		{
+			1, 0, true,
+			"1-1\n2:2 x\n--\n6-6\n7:7 x\n8-8\n9:9 x\n",
+		},
+		{
+			// nakładające się grupy są łączone
+			2, 2, true,
+			"1-1\n2:2 x\n3-3\n4-4\n5-5\n6-6\n7:7 x\n8-8\n9:9 x\n10-10\n11-11\n",
+		},
+		{
+			// grupy sąsiadujące bez separatora
+			1, 1, false,
+			"1\n2 x\n3\n--\n6\n7 x\n8\n9 x\n10\n",
+		},
+	}
+
+	pat, err := pattern.Makepat("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range tests {
+		before = tc.before
+		after = tc.after
+		number = tc.number
+		w := new(bytes.Buffer)
+		err := find(w, bytes.NewBufferString(in), pat, "")
+		if err != nil {
+			t.Error(err)
+		}
+		if w.String() != tc.out {
+			t.Errorf("#%d: oczekiwano: %q, jest: %q", i, tc.out, w.String())
+		}
+	}
+
+	// nazwa pliku i numer wiersza
+	before = 1
+	after = 0
+	number = true
+	w := new(bytes.Buffer)
+	err = find(w, bytes.NewBufferString("a\nb x\n"), pat, "f")
+	if err != nil {
+		t.Error(err)
+	}
+	exp := "f-1-a\nf:2:b x\n"
+	if w.String() != exp {
+		t.Errorf("oczekiwano: %q, jest: %q", exp, w.String())
+	}
+}
+
+func TestSetContext(t *testing.T) {
+	defer func() {
+		before = 0
+		after = 0
+	}()
+
+	tests := []struct {
+		args   []string
+		after  int
+		before int
+	}{
+		{nil, 0, 0},
+		{[]string{"-C", "2"}, 2, 2},
+		{[]string{"-A", "1"}, 1, 0},
+		{[]string{"-C", "2", "-A", "0"}, 0, 2},
+		{[]string{"-B", "0", "-C", "2"}, 2, 0},
+		{[]string{"-C", "2", "-A", "1", "-B", "3"}, 1, 3},
+		{[]string{"-C", "0", "-A", "1"}, 1, 0},
+	}
+
+	for i, tc := range tests {
+		fs := flag.NewFlagSet("find", flag.ContinueOnError)
+		fs.IntVar(&after, "A", 0, "")
+		fs.IntVar(&before, "B", 0, "")
+		context := fs.Int("C", 0, "")
+		err := fs.Parse(tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) {
+			set[f.Name] = true
+		})
+		setContext(*context, set)
+		if after != tc.after || before != tc.before {
+			t.Errorf("#%d: %q: oczekiwano: -A %d -B %d, jest: -A %d -B %d",
+				i, tc.args, tc.after, tc.before, after, before)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	tests := []struct {
+		lin string
+		pat string
+		sp  [][2]int
+	}{
+		{"abc\n", "x", nil},
+		{"abcabc\n", "b", [][2]int{{1, 2}, {4, 5}}},
+		{"ąbą\n", "ą", [][2]int{{0, 2}, {3, 5}}},
+		{"xaax\n", "a*", [][2]int{{1, 3}}},
+		{"xxx\n", "a*", [][2]int{{0, 0}}},
+		{"abc\n", "%", [][2]int{{0, 0}}},
+		{"abc\n", "c$", [][2]int{{2, 3}}},
+	}
+
+	for i, tc := range tests {
+		pat, err := pattern.Makepat(tc.pat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sp := spans(tc.lin, pat)
+		if !reflect.DeepEqual(sp, tc.sp) {
+			t.Errorf("#%d: oczekiwano: %v, jest: %v", i, tc.sp, sp)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	defer func() {
+		color = false
+	}()
+
+	pat, err := pattern.Makepat("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	color = true
+	w := new(bytes.Buffer)
+	err = find(w, bytes.NewBufferString("abcb\nxyz\n"), pat, "")
+	if err != nil {
+		t.Error(err)
+	}
+	exp := "a" + colorStart + "b" + colorEnd + "c" +
+		colorStart + "b" + colorEnd + "\n"
+	if w.String() != exp {
+		t.Errorf("oczekiwano: %q, jest: %q", exp, w.String())
+	}
+}
+
+func TestFindJSON(t *testing.T) {
+	defer func() {
+		jsonOut = false
+	}()
+
+	pat, err := pattern.Makepat("b?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonOut = true
+	w := new(bytes.Buffer)
+	err = find(w, bytes.NewBufferString("abcb\nxyz\nąb!\n"), pat, "f.txt")
+	if err != nil {
+		t.Error(err)
+	}
+	exp := `{"file":"f.txt","line":1,"offset":1,"text":"bc"}` + "\n" +
+		`{"file":"f.txt","line":3,"offset":11,"text":"b!"}` + "\n"
+	if w.String() != exp {
+		t.Errorf("oczekiwano: %q, jest: %q", exp, w.String())
+	}
+}
@@ -20,6 +20,20 @@ func Match(lin string, pat Pattern) bool {
 	return false
 }
 
+// Index szuka w stringu lin, począwszy od indeksu offset, pierwszego
+// fragmentu pasującego do wzorca pat. Zwraca indeks początku i
+// długość (w bajtach) tego fragmentu lub -1 i 0 gdy wzorzec nie
+// pasuje. Długość może być zerowa, np. dla wzorca "%".
+func Index(lin string, offset int, pat Pattern) (int, int) {
+	for i := range lin[offset:] {
+		ok, n := Amatch(lin, offset+i, pat, 0)
+		if ok {
+			return offset + i, n
+		}
+	}
+	return -1, 0
+}
+
 // Amatch dopasowuje wzorzec zaczynający się od pat[j] do stringu
 // zaczynającego się od str[offset]. Jeśli wzorzec pasuje, to zwraca
 // true i liczbę bajtów str pasujących do wzorca.
@@ -79,6 +93,14 @@ func omatch(str string, i int, pat Pattern, j int) (bool, int) {
 		if i < len(str) && str[i] == '\n' {
 			return true, 0
 		}
+	case mbol:
+		if i == 0 || str[i-1] == '\n' {
+			return true, 0
+		}
+	case meol:
+		if i == len(str) || str[i] == '\n' {
+			return true, 0
+		}
 	case any:
 		r, n := utf8.DecodeRuneInString(str[i:])
 		if r != utf8.RuneError && r != '\n' {
@@ -92,12 +114,13 @@ func omatch(str string, i int, pat Pattern, j int) (bool, int) {
 		}
 	case ccl:
 		r, n := utf8.DecodeRuneInString(str[i:])
-		if locate(r, pat[j+1:]) {
+		if i < len(str) && locate(r, pat[j+1:]) {
 			return true, n
 		}
 	case nccl:
+		// na końcu stringu nie ma znaku do dopasowania
 		r, n := utf8.DecodeRuneInString(str[i:])
-		if !locate(r, pat[j+1:]) && r != '\n' {
+		if i < len(str) && !locate(r, pat[j+1:]) && r != '\n' {
 			return true, n
 		}
 	default:
@@ -131,7 +154,7 @@ func patsize(pat Pattern) int {
 	tag := pat[0]
 
 	switch tag {
-	case bol, eol, any:
+	case bol, eol, mbol, meol, any:
 		return 1
 	case litchar:
 		_, n := utf8.DecodeRuneInString(string(pat[1:]))
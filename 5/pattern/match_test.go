@@ -87,6 +87,11 @@ func TestOmatch(t *testing.T) {
 			"%xyz", 0,
 			false, 0,
 		},
+		{
+			"ab\ncd", 3, // po znaku '\n' wewnątrz stringu
+			"%xyz", 0,
+			false, 0,
+		},
 		// EOL
 		{
 			"abc\n", 3,
@@ -171,6 +176,11 @@ func TestOmatch(t *testing.T) {
 			"[^a-z]", 0,
 			false, 0,
 		},
+		{
+			"a", 1, // koniec stringu
+			"[^xyz]", 0,
+			false, 0,
+		},
 	}
 
 	for i, test := range tests {
@@ -355,6 +365,17 @@ func TestAmatch(t *testing.T) {
 			"%?b[0-9][^a-z]x$", 0,
 			false, 0,
 		},
+		// domknięcie klasy dopełnionej do końca stringu
+		{
+			"bb", 0,
+			"[^a]*", 0,
+			true, 2,
+		},
+		{
+			"bb", 2,
+			"[^a]*", 0,
+			true, 0,
+		},
 	}
 
 	for i, test := range tests {
@@ -451,3 +472,124 @@ func TestMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestIndex(t *testing.T) {
+	tests := []struct {
+		str    string
+		offset int
+		pat    string
+		i      int // indeks początku dopasowania
+		n      int // długość dopasowania
+	}{
+		{"abc", 0, "b", 1, 1},
+		{"abc", 0, "x", -1, 0},
+		{"", 0, "a", -1, 0},
+		{"abcabc", 1, "a", 3, 1},
+		{"abcabc", 4, "a", -1, 0},
+		{"ąbc", 0, "b?", 2, 2},
+		{"xx aaa\n", 0, "a*", 0, 0},
+		{"xx aaa\n", 0, "aa*", 3, 3},
+		{"ala ma kota\n", 0, "?ta$", 8, 3},
+		{"ala ma kota\n", 0, "%", 0, 0},
+		{"ala ma kota\n", 1, "%", -1, 0},
+	}
+
+	for i, test := range tests {
+		pat, err := Makepat(test.pat)
+		if err != nil {
+			t.Error(err)
+		}
+		ii, n := Index(test.str, test.offset, pat)
+		if ii != test.i || n != test.n {
+			t.Errorf("#%d: Index() oczekiwano: %d, %d, jest: %d, %d",
+				i, test.i, test.n, ii, n)
+		}
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	tests := []struct {
+		str    string
+		offset int
+		pat    string
+		i      int // indeks początku dopasowania
+		n      int // długość dopasowania
+	}{
+		{"ab\ncd", 0, "%c", 3, 1},
+		{"ab\ncd", 0, "b$", 1, 1},
+		{"ab\ncd", 0, "d$", 4, 1},
+		{"ab\ncd", 0, "%?*$", 0, 2},
+		{"ab\ncd", 1, "%?*$", 3, 2},
+		{"ab\ncd", 0, "b@nc", 1, 3},
+		{"ab\ncd", 0, "%b", -1, 0},
+		{"a%$\n", 0, "@%@$", 1, 2}, // znaki '%' i '$' bez znaczenia specjalnego
+		{"a\x01\x02", 0, "\x01\x02", 1, 2},
+	}
+
+	for i, test := range tests {
+		pat, err := Makepat(test.pat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ii, n := Index(test.str, test.offset, Multiline(pat))
+		if ii != test.i || n != test.n {
+			t.Errorf("#%d: Index() oczekiwano: %d, %d, jest: %d, %d",
+				i, test.i, test.n, ii, n)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		str    string
+		offset int
+		pat    string
+		i      int // indeks początku dopasowania
+		n      int // długość dopasowania
+	}{
+		{"Foo foo FOO", 0, "foo", 0, 3},
+		{"Foo foo FOO", 1, "foo", 4, 3},
+		{"Foo foo FOO", 5, "foo", 8, 3},
+		{"Foo foo FOO", 0, "FOO", 0, 3},
+		{"xŻÓŁW", 0, "żółw", 1, 7},
+		{"xaBc1", 0, "a[b-c]*1", 1, 4},
+		{"aB1", 0, "[^b]1", -1, 0},
+		{"aX1", 0, "[^b]1", 1, 2},
+		{"K", 0, "k", 0, 1},
+		{"K", 0, "k", 0, 3}, // znak kelvina
+		{"1?*", 0, "1@?", 0, 2},
+		{"ABC\n", 0, "%a?c$", 0, 3},
+	}
+
+	for i, test := range tests {
+		pat, err := Makepat(test.pat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pat, err = Fold(pat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ii, n := Index(test.str, test.offset, pat)
+		if ii != test.i || n != test.n {
+			t.Errorf("#%d: Index() oczekiwano: %d, %d, jest: %d, %d",
+				i, test.i, test.n, ii, n)
+		}
+	}
+
+	// klasa znaków przekraczająca maksymalny rozmiar po uzupełnieniu
+	class := []rune{'ÿ'} // 129 małych liter
+	for _, rng := range [][2]rune{{'a', 'z'}, {'à', 'ö'}, {'ø', 'þ'}, {'α', 'ρ'}, {'σ', 'ω'}, {'а', 'џ'}} {
+		for r := rng[0]; r <= rng[1]; r++ {
+			class = append(class, r)
+		}
+	}
+	pat, err := Makepat("[" + string(class) + "]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Fold(pat)
+	if err == nil {
+		t.Errorf("powinien wystąpić błąd rozmiaru klasy znaków")
+	}
+}
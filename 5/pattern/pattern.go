@@ -7,6 +7,7 @@ package pattern
 import (
 	"errors"
 	"fmt"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -35,6 +36,8 @@ const (
 	ccl
 	nccl
 	closure
+	mbol // bol we wzorcu wielowierszowym (patrz Multiline)
+	meol // eol we wzorcu wielowierszowym (patrz Multiline)
 )
 
 // Typ Pattern reprezentuje skompilowany wzorzec.
@@ -56,6 +59,10 @@ func (p Pattern) String() string {
 			out = append(out, "<BOL>"...)
 		case eol:
 			out = append(out, "<EOL>"...)
+		case mbol:
+			out = append(out, "<MBOL>"...)
+		case meol:
+			out = append(out, "<MEOL>"...)
 		case any:
 			out = append(out, "<ANY>"...)
 		case litchar:
@@ -159,6 +166,80 @@ func Makepat(str string) (Pattern, error) {
 	return Pattern(out), nil
 }
 
+// Multiline zwraca wzorzec p przystosowany do dopasowywania w
+// tekście zawierającym wiele wierszy: BOL pasuje na początku tekstu i
+// po każdym znaku '\n', a EOL przed każdym znakiem '\n' i na końcu
+// tekstu. We wzorcach zwracanych przez Makepat BOL pasuje tylko na
+// początku tekstu, a EOL tylko przed znakiem '\n'.
+func Multiline(p Pattern) Pattern {
+	out := []byte(p)
+	for j := 0; j < len(out); j += patsize(Pattern(out[j:])) {
+		switch out[j] {
+		case bol:
+			out[j] = mbol
+		case eol:
+			out[j] = meol
+		}
+	}
+	return Pattern(out)
+}
+
+// Fold zwraca wzorzec p, który pasuje do tekstu niezależnie od
+// wielkości liter: znaki są zastępowane klasami znaków zawierającymi
+// wszystkie ich odpowiedniki innej wielkości (patrz unicode.SimpleFold),
+// a klasy znaków są o te odpowiedniki uzupełniane. Zwraca błąd jeśli
+// klasa znaków przekroczy maksymalny rozmiar.
+func Fold(p Pattern) (Pattern, error) {
+	var out []byte
+	for j := 0; j < len(p); {
+		n := patsize(p[j:])
+		switch p[j] {
+		case litchar:
+			r, _ := utf8.DecodeRuneInString(string(p[j+1:]))
+			chars := foldRunes([]rune{r})
+			if len(chars) == 1 {
+				out = append(out, p[j:j+n]...)
+				break
+			}
+			out = append(out, ccl, byte(len(chars)))
+			for _, c := range chars {
+				out = appendUtf8(out, c)
+			}
+		case ccl, nccl:
+			var rs []rune
+			for _, r := range string(p[j+2 : j+n]) {
+				rs = append(rs, r)
+			}
+			chars := foldRunes(rs)
+			if len(chars) > maxChars {
+				return Pattern(out), fmt.Errorf("klasa zawiera więcej niż %d znaków: %d", maxChars, len(chars))
+			}
+			out = append(out, p[j], byte(len(chars)))
+			for _, c := range chars {
+				out = appendUtf8(out, c)
+			}
+		default:
+			out = append(out, p[j:j+n]...)
+		}
+		j += n
+	}
+	return Pattern(out), nil
+}
+
+// foldRunes zwraca znaki rs uzupełnione o ich odpowiedniki innej
+// wielkości, bez powtórzeń.
+func foldRunes(rs []rune) []rune {
+	var out []rune
+	seen := make(map[rune]bool)
+	for _, r := range rs {
+		for c := r; !seen[c]; c = unicode.SimpleFold(c) {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
 // stclose dodaje znacznik closure do wzorca pat przed segmentem
 // zaczynającym się od indeksu last.
 func stclose(pat []byte, last int) []byte {